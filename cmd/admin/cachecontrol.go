@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// backfillCacheControl sets the Cache-Control header of objects published before headers were set on upload
+func backfillCacheControl(args []string) error {
+	fs := flag.NewFlagSet("backfill-cache-control", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	objects := addObjectStoreFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "print the header each object would be given without changing any")
+	fs.Parse(args)
+
+	objectStore, err := objects.open(store.region)
+	if err != nil {
+		return err
+	}
+
+	changed, err := nasa_epic_api.BackfillCacheControl(objectStore, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		fmt.Printf("\nSet Cache-Control of %d objects. Paths to invalidate:\n", len(changed))
+		for _, changedPath := range nasa_epic_api.InvalidationPaths(changed) {
+			fmt.Println(changedPath)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// export writes the records of the catalogue to a file or stdout as JSON lines or CSV
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	format := fs.String("format", nasa_epic_api.ExportFormatJSONLines, "export format: jsonl or csv")
+	from := fs.String("from", "", "only export records recorded on or after this date (2006-01-02)")
+	to := fs.String("to", "", "only export records recorded on or before this date (2006-01-02)")
+	regionName := fs.String("region-name", "", "only export records of this watch region")
+	out := fs.String("out", "", "file to write the export to. Defaults to stdout")
+	fs.Parse(args)
+
+	filter := nasa_epic_api.RecordingFilter{Region: *regionName}
+	if *from != "" {
+		fromDate, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			return fmt.Errorf("unable to parse -from: %v", err)
+		}
+		filter.From = fromDate
+	}
+	if *to != "" {
+		toDate, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			return fmt.Errorf("unable to parse -to: %v", err)
+		}
+		// include the whole of the last day
+		filter.To = toDate.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	recordingStore, err := store.open()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if *out != "" {
+		var err2 error
+		file, err2 = os.Create(*out)
+		if err2 != nil {
+			return fmt.Errorf("unable to create %s: %v", *out, err2)
+		}
+		w = file
+	}
+
+	exported, err := nasa_epic_api.ExportRecords(recordingStore, filter, *format, w)
+	if file != nil {
+		// the export is only complete once the file has been closed successfully
+		err2 := file.Close()
+		if err == nil && err2 != nil {
+			err = fmt.Errorf("unable to write %s: %v", *out, err2)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// stdout may be holding the export itself
+	fmt.Fprintf(os.Stderr, "Exported %d records\n", exported)
+
+	return nil
+}
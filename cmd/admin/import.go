@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// importRecords upserts the records of an export into the recording store, which need not be the store the export
+// was taken from
+func importRecords(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	format := fs.String("format", nasa_epic_api.ExportFormatJSONLines, "import format: jsonl or csv")
+	in := fs.String("in", "", "file to read the export from. Defaults to stdin")
+	fs.Parse(args)
+
+	recordingStore, err := store.open()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		file, err2 := os.Open(*in)
+		if err2 != nil {
+			return fmt.Errorf("unable to open %s: %v", *in, err2)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	imported, err := nasa_epic_api.ImportRecords(recordingStore, *format, r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d records\n", imported)
+
+	return nil
+}
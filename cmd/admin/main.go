@@ -0,0 +1,200 @@
+// Command admin runs maintenance tasks against the recording store outside of the Lambda.
+//
+// Usage:
+//
+//	admin <command> [flags]
+//
+// Store flags default to the same envars as the Lambda so the two can share a configuration
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// commands maps each sub command name to the function which runs it with the remaining arguments
+var commands = map[string]func(args []string) error{
+	"backfill-cache-control": backfillCacheControl,
+	"check-theme":            checkTheme,
+	"export":                 export,
+	"import":                 importRecords,
+	"migrate-keys":           migrateKeys,
+	"migrate-schema":         migrateSchema,
+	"prune":                  prune,
+	"runs":                   runs,
+	"timelapse":              timeLapse,
+	"verify":                 verify,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, found := commands[os.Args[1]]
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	err := command(os.Args[2:])
+	if err != nil {
+		log.Fatalf("%s failed: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: admin <command> [flags]\n\ncommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+}
+
+// storeFlags are the flags shared by every command which opens the recording store
+type storeFlags struct {
+	backend      string
+	path         string
+	tableName    string
+	region       string
+	endpointURL  string
+	scanSegments int
+}
+
+func addStoreFlags(fs *flag.FlagSet) *storeFlags {
+	f := &storeFlags{}
+	fs.StringVar(&f.backend, "store", envOrDefault("recordingStore", "dynamodb"), "recording store backend: dynamodb, file or memory")
+	fs.StringVar(&f.path, "store-path", envOrDefault("recordingStorePath", ""), "path of the log file when using the file recording store")
+	fs.StringVar(&f.tableName, "table", envOrDefault("dbTableName", ""), "DynamoDB table name")
+	fs.StringVar(&f.region, "region", envOrDefault("region", "eu-west-1"), "AWS region")
+	fs.StringVar(&f.endpointURL, "dynamodb-endpoint", envOrDefault("dynamoDBEndpointURL", ""), "DynamoDB endpoint URL, e.g. of DynamoDB Local")
+	fs.IntVar(&f.scanSegments, "scan-segments", envOrDefaultInt("dbScanSegments", 1), "number of parallel segments used to scan the DynamoDB table")
+	return f
+}
+
+func (f *storeFlags) open() (nasa_epic_api.RecordingStore, error) {
+	return nasa_epic_api.NewRecordingStore(nasa_epic_api.RecordingStoreConfig{
+		Backend:   f.backend,
+		TableName: f.tableName,
+		FilePath:  f.path,
+		AWS:       f.awsConfig(),
+
+		ScanSegments: f.scanSegments,
+	})
+}
+
+// awsConfig returns the configuration of the DynamoDB client. Static credentials are only read from envars
+func (f *storeFlags) awsConfig() nasa_epic_api.AWSClientConfig {
+	return awsClientConfigFromEnv("dynamoDB", f.region, f.endpointURL)
+}
+
+// objectStoreFlags are the flags shared by every command which opens the object store
+type objectStoreFlags struct {
+	backend string
+	bucket  string
+	path    string
+	baseURL string
+
+	endpointURL  string
+	usePathStyle bool
+
+	private       bool
+	presignExpiry time.Duration
+}
+
+func addObjectStoreFlags(fs *flag.FlagSet) *objectStoreFlags {
+	f := &objectStoreFlags{}
+	fs.StringVar(&f.backend, "object-store", envOrDefault("objectStore", "s3"), "object store backend: s3 or file")
+	fs.StringVar(&f.bucket, "bucket", envOrDefault("uploadS3BucketName", ""), "S3 bucket holding the images")
+	fs.StringVar(&f.path, "object-store-path", envOrDefault("objectStorePath", ""), "site directory when using the file object store")
+	fs.StringVar(&f.baseURL, "object-store-base-url", envOrDefault("objectStoreBaseURL", ""), "base URL objects are served from, if not the bucket's own URL")
+	fs.StringVar(&f.endpointURL, "s3-endpoint", envOrDefault("s3EndpointURL", ""), "S3 endpoint URL, e.g. of MinIO")
+	fs.BoolVar(&f.usePathStyle, "s3-path-style", envOrDefaultBool("s3UsePathStyle", false), "address buckets in the URL path rather than the host name")
+	fs.BoolVar(&f.private, "private", envOrDefaultBool("objectStorePrivate", false), "the bucket is private and served through an authenticated gateway at the base URL")
+	fs.DurationVar(&f.presignExpiry, "presign-expiry", envOrDefaultDuration("presignExpiry", nasa_epic_api.DefaultPresignExpiry), "how long the presigned URLs of a private bucket are valid for")
+	return f
+}
+
+// open returns the object store, in the AWS region shared with the recording store flags
+func (f *objectStoreFlags) open(region string) (nasa_epic_api.ObjectStore, error) {
+	clientConfig := awsClientConfigFromEnv("s3", region, f.endpointURL)
+	clientConfig.UsePathStyle = f.usePathStyle
+
+	return nasa_epic_api.NewObjectStore(nasa_epic_api.ObjectStoreConfig{
+		Backend:   f.backend,
+		Bucket:    f.bucket,
+		AWS:       clientConfig,
+		Directory: f.path,
+		BaseURL:   f.baseURL,
+
+		Private:       f.private,
+		PresignExpiry: f.presignExpiry,
+	})
+}
+
+// awsClientConfigFromEnv returns the configuration of an AWS client, with static credentials read from the same
+// envars as the Lambda, e.g. s3AccessKeyID and s3SecretAccessKey
+func awsClientConfigFromEnv(prefix, region, endpointURL string) nasa_epic_api.AWSClientConfig {
+	return nasa_epic_api.AWSClientConfig{
+		Region:          region,
+		EndpointURL:     endpointURL,
+		AccessKeyID:     envOrDefault(prefix+"AccessKeyID", ""),
+		SecretAccessKey: envOrDefault(prefix+"SecretAccessKey", ""),
+		SessionToken:    envOrDefault(prefix+"SessionToken", ""),
+	}
+}
+
+// envOrDefault looks up an environment variable and returns defaultValue if not found
+func envOrDefault(envarName, defaultValue string) string {
+	value, exists := os.LookupEnv(envarName)
+	if !exists {
+		return defaultValue
+	}
+	return value
+}
+
+func envOrDefaultInt(envarName string, defaultValue int) int {
+	value, err := strconv.Atoi(envOrDefault(envarName, strconv.Itoa(defaultValue)))
+	if err != nil {
+		log.Fatalf("unable to parse int for %s: %v", envarName, err)
+	}
+	return value
+}
+
+func envOrDefaultBool(envarName string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(envOrDefault(envarName, strconv.FormatBool(defaultValue)))
+	if err != nil {
+		log.Fatalf("unable to parse bool for %s: %v", envarName, err)
+	}
+	return value
+}
+
+func envOrDefaultFloat(envarName string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(envOrDefault(envarName, strconv.FormatFloat(defaultValue, 'f', -1, 64)), 64)
+	if err != nil {
+		log.Fatalf("unable to parse float64 for %s: %v", envarName, err)
+	}
+	return value
+}
+
+func envOrDefaultDuration(envarName string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(envOrDefault(envarName, defaultValue.String()))
+	if err != nil {
+		log.Fatalf("unable to parse duration for %s: %v", envarName, err)
+	}
+	return value
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// migrateSchema backfills records written by older versions of the pipeline up to the current schema version
+func migrateSchema(args []string) error {
+	fs := flag.NewFlagSet("migrate-schema", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	regionName := fs.String("region-name", envOrDefault("targetRegionName", "default"), "watch region assigned to records without one")
+	dryRun := fs.Bool("dry-run", false, "print the records which would be migrated without writing them")
+	fs.Parse(args)
+
+	recordingStore, err := store.open()
+	if err != nil {
+		return err
+	}
+
+	migrated, err := nasa_epic_api.MigrateRecords(recordingStore, *regionName, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Printf("\n%d records would be migrated to schema version %d\n", migrated, nasa_epic_api.CurrentSchemaVersion)
+	} else {
+		fmt.Printf("\nMigrated %d records to schema version %d\n", migrated, nasa_epic_api.CurrentSchemaVersion)
+	}
+
+	return nil
+}
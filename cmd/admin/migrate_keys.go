@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// migrateKeys copies records from a table using the old Identifier/FormattedDateStr key to one using the
+// RecordID/Timestamp key, verifying each copy
+func migrateKeys(args []string) error {
+	fs := flag.NewFlagSet("migrate-keys", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	sourceTable := fs.String("source-table", "", "DynamoDB table keyed on Identifier and FormattedDateStr to copy from")
+	dryRun := fs.Bool("dry-run", false, "print the records which would be copied without writing them")
+	fs.Parse(args)
+
+	if *sourceTable == "" || store.tableName == "" {
+		return fmt.Errorf("both -source-table and -table must be set")
+	}
+
+	client, err := nasa_epic_api.CreateDBClient(store.awsConfig())
+	if err != nil {
+		return err
+	}
+
+	copied, err := nasa_epic_api.MigrateTableKeys(client, *sourceTable, store.tableName, store.scanSegments, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Printf("\n%d records would be copied from %s to %s\n", copied, *sourceTable, store.tableName)
+	} else {
+		fmt.Printf("\nCopied %d records from %s to %s\n", copied, *sourceTable, store.tableName)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// prune deletes the records and images which fall outside of the retention policy
+func prune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	objects := addObjectStoreFlags(fs)
+	maxAgeDays := fs.Int("max-age-days", envOrDefaultInt("retentionMaxAgeDays", 0), "prune records older than this many days. 0 disables")
+	maxCount := fs.Int("max-count", envOrDefaultInt("retentionMaxCountPerRegion", 0), "prune all but this many of the most recent records per region. 0 disables")
+	keepBest := fs.Int("keep-best", envOrDefaultInt("retentionKeepBest", 0), "always keep this many records per region taken closest to local solar noon")
+	dryRun := fs.Bool("dry-run", false, "print the records and objects which would be deleted without deleting them")
+	fs.Parse(args)
+
+	policy := nasa_epic_api.RetentionPolicy{
+		MaxAge:            time.Duration(*maxAgeDays) * 24 * time.Hour,
+		MaxCountPerRegion: *maxCount,
+		KeepBest:          *keepBest,
+	}
+	if !policy.Enabled() {
+		return fmt.Errorf("at least one of -max-age-days or -max-count must be set")
+	}
+
+	recordingStore, err := store.open()
+	if err != nil {
+		return err
+	}
+
+	objectStore, err := objects.open(store.region)
+	if err != nil {
+		return err
+	}
+
+	pruned, err := nasa_epic_api.PruneRecordings(recordingStore, objectStore, policy, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Printf("\n%d records would be pruned\n", len(pruned))
+	} else {
+		fmt.Printf("\nPruned %d records\n", len(pruned))
+	}
+
+	return nil
+}
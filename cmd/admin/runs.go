@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// runs lists past runs of the pipeline, or prints the full summary of a single run
+func runs(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	runsTableName := fs.String("runs-table", envOrDefault("runsTableName", ""), "DynamoDB table holding the run history")
+	limit := fs.Int("limit", 20, "number of most recent runs to list. 0 lists all runs")
+	runID := fs.String("id", "", "print the full summary of this run")
+	fs.Parse(args)
+
+	runStore, err := nasa_epic_api.NewRunStore(nasa_epic_api.RecordingStoreConfig{
+		Backend:       store.backend,
+		FilePath:      store.path,
+		AWS:           store.awsConfig(),
+		RunsTableName: *runsTableName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *runID != "" {
+		run, err2 := runStore.GetRun(*runID)
+		if err2 != nil {
+			return err2
+		}
+		if run == nil {
+			return fmt.Errorf("run %s not found", *runID)
+		}
+
+		output, err2 := json.MarshalIndent(run, "", "  ")
+		if err2 != nil {
+			return fmt.Errorf("unable to marshal run %s: %v", *runID, err2)
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+
+	history, err := runStore.ListRuns(*limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN ID\tSTARTED\tDURATION\tDATES\tSEEN\tMATCHED\tUPLOADED\tSKIPPED\tBYTES\tERRORS\tNOTIFICATION")
+	for _, run := range history {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			run.RunID, run.StartTime.Format(time.RFC3339), run.Duration().Round(time.Second), run.DatesFetched,
+			run.RecordingsSeen, run.Matched, run.Uploaded, run.Skipped, run.BytesTransferred, len(run.Errors),
+			run.NotificationStatus)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// checkTheme validates a theme's overrides of the default templates and assets without running the pipeline
+func checkTheme(args []string) error {
+	fs := flag.NewFlagSet("check-theme", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	objects := addObjectStoreFlags(fs)
+	directory := fs.String("theme-dir", envOrDefault("themeDirectory", ""), "local directory of theme override files")
+	prefix := fs.String("theme-prefix", envOrDefault("themePrefix", ""), "object store key prefix of theme override files")
+	fs.Parse(args)
+
+	// the object store is only needed to read overrides from a prefix
+	var objectStore nasa_epic_api.ObjectStore
+	if *prefix != "" {
+		var err error
+		objectStore, err = objects.open(store.region)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := nasa_epic_api.LoadTheme(nasa_epic_api.ThemeConfig{Directory: *directory, Prefix: *prefix}, objectStore)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Theme is valid")
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// timeLapse builds an animated GIF of a region's recordings between two dates and uploads it to the object store
+func timeLapse(args []string) error {
+	fs := flag.NewFlagSet("timelapse", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	objects := addObjectStoreFlags(fs)
+	regionName := fs.String("region-name", envOrDefault("targetRegionName", "default"), "watch region whose recordings are the frames")
+	latMin := fs.Float64("lat-min", envOrDefaultFloat("targetCoordinateslatMin", 0), "southern edge of the region")
+	latMax := fs.Float64("lat-max", envOrDefaultFloat("targetCoordinateslatMax", 0), "northern edge of the region")
+	lonMin := fs.Float64("lon-min", envOrDefaultFloat("targetCoordinateslonMin", 0), "western edge of the region")
+	lonMax := fs.Float64("lon-max", envOrDefaultFloat("targetCoordinateslonMax", 0), "eastern edge of the region")
+	from := fs.String("from", "", "first date of the time-lapse (2006-01-02). Defaults to 30 days before -to")
+	to := fs.String("to", "", "last date of the time-lapse (2006-01-02). Defaults to today")
+	frameDelay := fs.Duration("frame-delay", envOrDefaultDuration("timeLapseFrameDelay", nasa_epic_api.DefaultTimeLapseFrameDelay), "time each frame is shown for")
+	width := fs.Int("width", envOrDefaultInt("timeLapseWidth", nasa_epic_api.DefaultTimeLapseWidth), "width of the frames in pixels")
+	palette := fs.String("palette", envOrDefault("timeLapsePalette", nasa_epic_api.TimeLapsePaletteAdaptive), "colour palette: adaptive, plan9 or websafe")
+	paletteSize := fs.Int("palette-size", envOrDefaultInt("timeLapsePaletteSize", 256), "number of colours of the adaptive palette, up to 256")
+	key := fs.String("key", "", "object key of the time-lapse. Defaults to timelapse/<region>/<from>_<to>.gif")
+	fs.Parse(args)
+
+	toDate := time.Now().UTC()
+	if *to != "" {
+		var err error
+		toDate, err = time.Parse("2006-01-02", *to)
+		if err != nil {
+			return fmt.Errorf("unable to parse -to: %v", err)
+		}
+	}
+	// include the whole of the last day
+	toDate = toDate.Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
+
+	fromDate := toDate.Truncate(24*time.Hour).AddDate(0, 0, -30)
+	if *from != "" {
+		var err error
+		fromDate, err = time.Parse("2006-01-02", *from)
+		if err != nil {
+			return fmt.Errorf("unable to parse -from: %v", err)
+		}
+	}
+
+	recordingStore, err := store.open()
+	if err != nil {
+		return err
+	}
+
+	objectStore, err := objects.open(store.region)
+	if err != nil {
+		return err
+	}
+
+	published, frames, err := nasa_epic_api.GenerateTimeLapse(recordingStore, objectStore, nasa_epic_api.TimeLapseOptions{
+		Region: *regionName,
+		Coordinates: map[string]float64{
+			"latMin": *latMin,
+			"latMax": *latMax,
+			"lonMin": *lonMin,
+			"lonMax": *lonMax,
+		},
+		From:        fromDate,
+		To:          toDate,
+		FrameDelay:  *frameDelay,
+		Width:       *width,
+		Palette:     *palette,
+		PaletteSize: *paletteSize,
+		Key:         *key,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Published time-lapse of %d frames at %s\n", frames, objectStore.PublicURL(published))
+
+	return nil
+}
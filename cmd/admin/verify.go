@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"nasa-epic-project/internal/nasa-epic-api"
+)
+
+// verify reports differences between the recording store and the images in the bucket, optionally repairing them
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	store := addStoreFlags(fs)
+	objects := addObjectStoreFlags(fs)
+	regionName := fs.String("region-name", envOrDefault("targetRegionName", "default"), "watch region assigned to records re-linked to orphaned images")
+	repair := fs.Bool("repair", false, "re-download missing or mismatched images, backfill hashes and re-link or delete orphaned images")
+	fs.Parse(args)
+
+	recordingStore, err := store.open()
+	if err != nil {
+		return err
+	}
+
+	objectStore, err := objects.open(store.region)
+	if err != nil {
+		return err
+	}
+
+	inconsistencies, err := nasa_epic_api.VerifyRecordings(recordingStore, objectStore)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ISSUE\tOBJECT KEY\tITEM\tDETAIL")
+	for _, inconsistency := range inconsistencies {
+		identifier := "-"
+		if inconsistency.Record != nil {
+			identifier = inconsistency.Record.Identifier
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", inconsistency.Issue, inconsistency.Key, identifier, inconsistency.Detail)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nFound %d inconsistencies\n", len(inconsistencies))
+
+	if !*repair || len(inconsistencies) == 0 {
+		return nil
+	}
+
+	repaired, err := nasa_epic_api.RepairRecordings(recordingStore, objectStore, *regionName, inconsistencies)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nRepaired %d of %d inconsistencies\n", repaired, len(inconsistencies))
+
+	return nil
+}
@@ -4,30 +4,64 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"nasa-epic-project/internal/nasa-epic-api"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 )
 
 var (
+	recordingStoreBackend  string
+	recordingStorePath     string
+	dbScanSegments         int
+	claimLeaseDuration     time.Duration
+	useWatermark           bool
+	catchUpMaxDays         int
 	dbTableName            string
+	runsTableName          string
+	objectStoreBackend     string
+	objectStorePath        string
+	objectStoreBaseURL     string
+	objectStorePrivate     bool
+	presignExpiry          time.Duration
 	uploadS3BucketName     string
 	region                 string
+	dynamoDBClientConfig   nasa_epic_api.AWSClientConfig
+	s3ClientConfig         nasa_epic_api.AWSClientConfig
+	sesClientConfig        nasa_epic_api.AWSClientConfig
 	emailSender            string
 	emailRecipientsStr     string
 	dayRangeStr            string
+	targetRegionName       string
 	targetCoordinatesRange = map[string]float64{}
+	solarTimeWindow        *nasa_epic_api.SolarTimeWindow
+	retentionPolicy        nasa_epic_api.RetentionPolicy
+	pruneAtEndOfRun        bool
+	galleryOptions         nasa_epic_api.GalleryOptions
+	timeLapseDays          int
+	timeLapseOptions       nasa_epic_api.TimeLapseOptions
+	changeDetection        *nasa_epic_api.ChangeDetectionOptions
+	themeConfig            nasa_epic_api.ThemeConfig
 
 	emailRecipients []string
 )
 
 func init() {
 	// load all envars
+	recordingStoreBackend = loadOptionalEnvar("recordingStore", "dynamodb")
+	recordingStorePath = loadOptionalEnvar("recordingStorePath", "")
 	dbTableName = loadEnvar("dbTableName")
+	runsTableName = loadOptionalEnvar("runsTableName", "")
+	objectStoreBackend = loadOptionalEnvar("objectStore", "s3")
+	objectStorePath = loadOptionalEnvar("objectStorePath", "")
+	objectStoreBaseURL = loadOptionalEnvar("objectStoreBaseURL", "")
 	uploadS3BucketName = loadEnvar("uploadS3BucketName")
 	region = loadEnvar("region")
 	emailSender = loadEnvar("emailSender")
@@ -54,6 +88,102 @@ func init() {
 	if err != nil {
 		log.Fatalf("unable to parse float64 for lonMax: %v", err)
 	}
+
+	targetRegionName = loadOptionalEnvar("targetRegionName", "default")
+
+	dbScanSegments = loadOptionalIntEnvar("dbScanSegments", 1)
+	catchUpMaxDays = loadOptionalIntEnvar("catchUpMaxDays", 30)
+
+	useWatermark, err = strconv.ParseBool(loadOptionalEnvar("useWatermark", "true"))
+	if err != nil {
+		log.Fatalf("unable to parse bool for useWatermark: %v", err)
+	}
+	// the watermark is persisted in the run history, which DynamoDB only keeps when given a runs table
+	if useWatermark && recordingStoreBackend == "dynamodb" && runsTableName == "" {
+		log.Fatalf("useWatermark requires runsTableName to be set for the dynamodb recording store, or set useWatermark=false")
+	}
+
+	claimLeaseDuration, err = time.ParseDuration(loadOptionalEnvar("claimLeaseDuration", "15m"))
+	if err != nil {
+		log.Fatalf("unable to parse duration for claimLeaseDuration: %v", err)
+	}
+
+	retentionPolicy = nasa_epic_api.RetentionPolicy{
+		MaxAge:            time.Duration(loadOptionalIntEnvar("retentionMaxAgeDays", 0)) * 24 * time.Hour,
+		MaxCountPerRegion: loadOptionalIntEnvar("retentionMaxCountPerRegion", 0),
+		KeepBest:          loadOptionalIntEnvar("retentionKeepBest", 0),
+	}
+
+	pruneAtEndOfRun, err = strconv.ParseBool(loadOptionalEnvar("pruneAtEndOfRun", "false"))
+	if err != nil {
+		log.Fatalf("unable to parse bool for pruneAtEndOfRun: %v", err)
+	}
+
+	galleryOptions = nasa_epic_api.GalleryOptions{
+		PageSize: loadOptionalIntEnvar("galleryPageSize", nasa_epic_api.DefaultGalleryPageSize),
+		FeedSize: loadOptionalIntEnvar("feedSize", nasa_epic_api.DefaultFeedSize),
+	}
+	galleryOptions.RSS, err = strconv.ParseBool(loadOptionalEnvar("publishRSS", "false"))
+	if err != nil {
+		log.Fatalf("unable to parse bool for publishRSS: %v", err)
+	}
+
+	timeLapseDays = loadOptionalIntEnvar("timeLapseDays", 0)
+	timeLapseOptions = nasa_epic_api.TimeLapseOptions{
+		Region:      targetRegionName,
+		Coordinates: targetCoordinatesRange,
+		Width:       loadOptionalIntEnvar("timeLapseWidth", nasa_epic_api.DefaultTimeLapseWidth),
+		Palette:     loadOptionalEnvar("timeLapsePalette", nasa_epic_api.TimeLapsePaletteAdaptive),
+		PaletteSize: loadOptionalIntEnvar("timeLapsePaletteSize", 256),
+		Key:         nasa_epic_api.LatestTimeLapseKey(targetRegionName),
+	}
+	timeLapseOptions.FrameDelay, err = time.ParseDuration(loadOptionalEnvar("timeLapseFrameDelay", nasa_epic_api.DefaultTimeLapseFrameDelay.String()))
+	if err != nil {
+		log.Fatalf("unable to parse duration for timeLapseFrameDelay: %v", err)
+	}
+
+	detectChanges, err := strconv.ParseBool(loadOptionalEnvar("changeDetection", "false"))
+	if err != nil {
+		log.Fatalf("unable to parse bool for changeDetection: %v", err)
+	}
+	if detectChanges {
+		changeDetection = &nasa_epic_api.ChangeDetectionOptions{Coordinates: targetCoordinatesRange}
+		changeDetection.Threshold, err = strconv.ParseFloat(loadOptionalEnvar("changeThreshold",
+			strconv.FormatFloat(nasa_epic_api.DefaultChangeThreshold, 'f', -1, 64)), 64)
+		if err != nil {
+			log.Fatalf("unable to parse float64 for changeThreshold: %v", err)
+		}
+	}
+
+	themeConfig = nasa_epic_api.ThemeConfig{
+		Directory: loadOptionalEnvar("themeDirectory", ""),
+		Prefix:    loadOptionalEnvar("themePrefix", ""),
+	}
+
+	objectStorePrivate, err = strconv.ParseBool(loadOptionalEnvar("objectStorePrivate", "false"))
+	if err != nil {
+		log.Fatalf("unable to parse bool for objectStorePrivate: %v", err)
+	}
+
+	presignExpiry, err = time.ParseDuration(loadOptionalEnvar("presignExpiry", nasa_epic_api.DefaultPresignExpiry.String()))
+	if err != nil {
+		log.Fatalf("unable to parse duration for presignExpiry: %v", err)
+	}
+
+	dynamoDBClientConfig = loadAWSClientConfig("dynamoDB")
+	sesClientConfig = loadAWSClientConfig("ses")
+	s3ClientConfig = loadAWSClientConfig("s3")
+	s3ClientConfig.UsePathStyle, err = strconv.ParseBool(loadOptionalEnvar("s3UsePathStyle", "false"))
+	if err != nil {
+		log.Fatalf("unable to parse bool for s3UsePathStyle: %v", err)
+	}
+
+	solarTimeWindow, err = nasa_epic_api.NewSolarTimeWindow(
+		loadOptionalEnvar("localSolarTimeMin", ""),
+		loadOptionalEnvar("localSolarTimeMax", ""))
+	if err != nil {
+		log.Fatalf("unable to parse local solar time window: %v", err)
+	}
 }
 
 // loadEnvar looks up an environment variable and exits the program if not found
@@ -67,21 +197,108 @@ func loadEnvar(envarName string) string {
 	return value
 }
 
-func handler() {
-	websiteURL := fmt.Sprintf("http://%s.s3-website-%s.amazonaws.com", uploadS3BucketName, region)
+// loadOptionalEnvar looks up an environment variable and returns defaultValue if not found
+func loadOptionalEnvar(envarName, defaultValue string) string {
+	value, exists := os.LookupEnv(envarName)
+	if !exists {
+		return defaultValue
+	}
+	return value
+}
 
-	dbclient, err := nasa_epic_api.CreateDBClient(region)
+// loadOptionalIntEnvar looks up an integer environment variable, returning defaultValue if not found and exiting
+// the program if it cannot be parsed
+func loadOptionalIntEnvar(envarName string, defaultValue int) int {
+	value, err := strconv.Atoi(loadOptionalEnvar(envarName, strconv.Itoa(defaultValue)))
+	if err != nil {
+		log.Fatalf("unable to parse int for %s: %v", envarName, err)
+	}
+	return value
+}
+
+// loadAWSClientConfig loads the optional endpoint and static credentials of an AWS client from the envars named
+// after prefix, e.g. s3EndpointURL, s3AccessKeyID, s3SecretAccessKey and s3SessionToken
+func loadAWSClientConfig(prefix string) nasa_epic_api.AWSClientConfig {
+	return nasa_epic_api.AWSClientConfig{
+		Region:          region,
+		EndpointURL:     loadOptionalEnvar(prefix+"EndpointURL", ""),
+		AccessKeyID:     loadOptionalEnvar(prefix+"AccessKeyID", ""),
+		SecretAccessKey: loadOptionalEnvar(prefix+"SecretAccessKey", ""),
+		SessionToken:    loadOptionalEnvar(prefix+"SessionToken", ""),
+	}
+}
+
+// runOutput is the result of an invocation, returned to the caller such as a workflow which invalidates a CDN
+type runOutput struct {
+	RunID string `json:"run_id"`
+	// ChangedPaths are the paths of every object uploaded or deleted by the run
+	ChangedPaths []string `json:"changed_paths"`
+}
+
+func handler() (runOutput, error) {
+	websiteURL := objectStoreBaseURL
+	if websiteURL == "" && objectStoreBackend == "file" {
+		// without a base URL the email links to the pages as local files
+		directory, err := filepath.Abs(objectStorePath)
+		if err != nil {
+			panic(fmt.Errorf("unable to resolve object store path %s: %v", objectStorePath, err))
+		}
+		websiteURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(directory)}).String()
+	} else if websiteURL == "" {
+		websiteURL = fmt.Sprintf("http://%s.s3-website-%s.amazonaws.com", uploadS3BucketName, region)
+	}
+
+	storeConfig := nasa_epic_api.RecordingStoreConfig{
+		Backend:   recordingStoreBackend,
+		TableName: dbTableName,
+		FilePath:  recordingStorePath,
+		AWS:       dynamoDBClientConfig,
+
+		ScanSegments:  dbScanSegments,
+		RunsTableName: runsTableName,
+	}
+
+	store, err := nasa_epic_api.NewRecordingStore(storeConfig)
 	if err != nil {
 		panic(err)
 	}
 
-	s3Client, err4 := nasa_epic_api.CreateS3Client()
+	// the run history is optional for DynamoDB, where it needs its own table
+	var runStore nasa_epic_api.RunStore
+	if recordingStoreBackend != "dynamodb" || runsTableName != "" {
+		runStore, err = nasa_epic_api.NewRunStore(storeConfig)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	run := nasa_epic_api.NewRunRecord(nasa_epic_api.NewRunID())
+	fmt.Printf("Starting run %s\n", run.RunID)
+	defer recordRun(runStore, run)
+
+	objectStore, err4 := nasa_epic_api.NewObjectStore(nasa_epic_api.ObjectStoreConfig{
+		Backend:   objectStoreBackend,
+		Bucket:    uploadS3BucketName,
+		AWS:       s3ClientConfig,
+		Directory: objectStorePath,
+		BaseURL:   objectStoreBaseURL,
+
+		Private:       objectStorePrivate,
+		PresignExpiry: presignExpiry,
+	})
 	if err4 != nil {
 		panic(err4)
 	}
 
+	// the theme is loaded and validated before any work is done so that a broken override fails the run straight away
+	theme, err := nasa_epic_api.LoadTheme(themeConfig, objectStore)
+	if err != nil {
+		panic(fmt.Errorf("invalid theme: %v", err))
+	}
+	galleryOptions.Theme = theme
+
 	err = nil
-	sesclient, err := nasa_epic_api.CreateSESClient(region)
+	sesclient, err := nasa_epic_api.CreateSESClient(sesClientConfig)
 	if err != nil {
 		panic(err)
 	}
@@ -105,37 +322,110 @@ func handler() {
 
 	nasa_epic_api.UpdateDateFieldDates(availableRecordingDates)
 
+	processOptions := nasa_epic_api.ProcessOptions{
+		StartDate:              startDate,
+		RegionName:             targetRegionName,
+		TargetCoordinatesRange: targetCoordinatesRange,
+		SolarTimeWindow:        solarTimeWindow,
+		Claim:                  nasa_epic_api.ClaimOptions{Owner: run.RunID, Lease: claimLeaseDuration},
+		ChangeDetection:        changeDetection,
+	}
+
+	// resume from the last fully processed date rather than the fixed day window, which is then only used
+	// for the very first run
+	if useWatermark && runStore != nil {
+		processOptions.StartDate, err = nasa_epic_api.WatermarkStartDate(runStore, targetRegionName, startDate)
+		if err != nil {
+			panic(err)
+		}
+		processOptions.MaxDates = catchUpMaxDays
+		processOptions.DateCompleted = nasa_epic_api.NewWatermarkAdvancer(runStore, targetRegionName, availableRecordingDates)
+	}
+
 	matchedCoordinateRecords, err3 := nasa_epic_api.ProcessRecordingDates(
-		dbclient, dbTableName, s3Client, uploadS3BucketName,
-		availableRecordingDates, startDate, targetCoordinatesRange)
+		store, objectStore, availableRecordingDates, processOptions, run)
 	if err3 != nil {
+		// recordings written before the failure are reported now, as later runs skip them as already present
+		if len(matchedCoordinateRecords) > 0 {
+			err = sendReport(matchedCoordinateRecords, sesclient, websiteURL, theme, objectStore, run)
+			if err != nil {
+				log.Printf("%v\n", err)
+			}
+		}
 		panic(err3)
 	}
 
+	// keys of every object uploaded or deleted, for CDN invalidation
+	var changedKeys []string
+	for _, recording := range matchedCoordinateRecords {
+		changedKeys = append(changedKeys, recording.S3Key)
+		if recording.Change != nil {
+			changedKeys = append(changedKeys, recording.Change.DiffKey)
+		}
+	}
+
+	// apply the retention policy before building the index so that pruned records are no longer listed
+	if pruneAtEndOfRun && retentionPolicy.Enabled() {
+		pruned, err5 := nasa_epic_api.PruneRecordings(store, objectStore, retentionPolicy, false)
+		if err5 != nil {
+			panic(err5)
+		}
+		fmt.Printf("\nPruned %d items under the retention policy\n", len(pruned))
+		for _, record := range pruned {
+			changedKeys = append(changedKeys, record.ObjectKey())
+			if record.Change != nil {
+				changedKeys = append(changedKeys, record.Change.DiffKey)
+			}
+		}
+	}
+
+	// the rolling time-lapse is generated before the index so that a new region's time-lapse is linked straight away.
+	// A region without recordings in the period is not a reason to fail the run
+	if timeLapseDays > 0 {
+		opts := timeLapseOptions
+		opts.To = time.Now().UTC()
+		opts.From = opts.To.AddDate(0, 0, -timeLapseDays)
+		key, frames, err6 := nasa_epic_api.GenerateTimeLapse(store, objectStore, opts)
+		if err6 != nil {
+			log.Printf("unable to generate time-lapse: %v\n", err6)
+		} else {
+			fmt.Printf("\nPublished time-lapse %s of %d frames\n", key, frames)
+			changedKeys = append(changedKeys, key)
+		}
+	}
+
 	// retrieve all records from database to generate HTML index file
-	allDBRecords, err4 := nasa_epic_api.RetrieveAllItemsAsStruct(dbclient, dbTableName)
+	allDBRecords, err4 := store.List(nasa_epic_api.RecordingFilter{})
 	if err4 != nil {
-		log.Printf("problems building struct slice from database items: %v\n", err4)
+		panic(fmt.Errorf("problems building struct slice from database items: %v", err4))
 	}
 
 	fmt.Printf("\nFound %d items in the database. Building HTML Index...\n", len(allDBRecords))
-	err = nasa_epic_api.GenerateHTMLIndex(allDBRecords, s3Client, uploadS3BucketName)
+	changedPages, err := nasa_epic_api.GenerateHTMLIndex(allDBRecords, objectStore, galleryOptions)
 	if err != nil {
-		log.Fatalf("an error occurred when attempting to generate the HTML content: %v\n", err)
+		panic(fmt.Errorf("an error occurred when attempting to generate the HTML content: %v", err))
 	}
+	fmt.Printf("Published %d changed pages\n", len(changedPages))
+	changedKeys = append(changedKeys, changedPages...)
+
+	changedCatalogue, err := nasa_epic_api.PublishCatalogue(allDBRecords, objectStore)
+	if err != nil {
+		panic(fmt.Errorf("an error occurred when attempting to publish the JSON catalogue: %v", err))
+	}
+	fmt.Printf("Published %d changed catalogue objects\n", len(changedCatalogue))
+	changedKeys = append(changedKeys, changedCatalogue...)
 
 	// print coordinate matches from this run to the console
 	if len(matchedCoordinateRecords) > 0 {
 		fmt.Printf("\nPrinting coordinate matches from this run which were not already present in the database (%s days history):\n", dayRangeStr)
 		for _, v := range matchedCoordinateRecords {
-			fmt.Printf("Identifier: %+v, S3Location: %+v DateString: %+v\n", v.Identifier, v.S3Location, v.DateString)
+			fmt.Printf("Identifier: %+v, S3Location: %+v DateString: %+v LocalSolarTime: %+v\n", v.Identifier, v.S3Location, v.DateString, v.LocalSolarTime)
 		}
 
 		// send email notifications as matches where found
-		err = nil
-		err := nasa_epic_api.SendEmailReport(matchedCoordinateRecords, sesclient, emailSender, emailRecipients, websiteURL)
+		err = sendReport(matchedCoordinateRecords, sesclient, websiteURL, theme, objectStore, run)
 		if err != nil {
-			log.Fatalf("problems sending email: %v", err)
+			panic(err)
 		}
 
 	} else {
@@ -144,9 +434,53 @@ func handler() {
 
 	fmt.Printf("\nPublic static website available at: %s\n", websiteURL)
 
+	output := runOutput{RunID: run.RunID, ChangedPaths: nasa_epic_api.InvalidationPaths(changedKeys)}
+	fmt.Printf("\n%d changed paths to invalidate:\n", len(output.ChangedPaths))
+	for _, changedPath := range output.ChangedPaths {
+		fmt.Println(changedPath)
+	}
+
 	// todo: add a logger
 	// todo: stats commented out for now. Cleanup
 	//nasa_epic_api.PrintStats(allRecordings, coordinateMatchesCount)
+
+	return output, nil
+}
+
+// sendReport emails the recordings matched by the run and records whether the notification was sent
+func sendReport(recordings []*nasa_epic_api.NasaEpicRecording, sesclient *sesv2.Client, websiteURL string, theme *nasa_epic_api.Theme, objectStore nasa_epic_api.ObjectStore, run *nasa_epic_api.RunRecord) error {
+	err := nasa_epic_api.SendEmailReport(recordings, sesclient, emailSender, emailRecipients, websiteURL, theme, objectStore)
+	if err != nil {
+		run.NotificationStatus = nasa_epic_api.NotificationStatusFailed
+		return fmt.Errorf("problems sending email: %v", err)
+	}
+	run.NotificationStatus = nasa_epic_api.NotificationStatusSent
+	return nil
+}
+
+// recordRun writes the run summary to the run history. It is deferred by handler, so also records any panic
+// before re-raising it
+func recordRun(runStore nasa_epic_api.RunStore, run *nasa_epic_api.RunRecord) {
+	r := recover()
+	if r != nil {
+		run.AddError(fmt.Errorf("%v", r))
+	}
+
+	run.EndTime = time.Now().UTC()
+	fmt.Printf("\nRun %s finished in %v: %d dates fetched, %d recordings seen, %d matched, %d uploaded, %d skipped, %d bytes, %d errors\n",
+		run.RunID, run.Duration(), run.DatesFetched, run.RecordingsSeen, run.Matched, run.Uploaded, run.Skipped,
+		run.BytesTransferred, len(run.Errors))
+
+	if runStore != nil {
+		err := runStore.PutRun(*run)
+		if err != nil {
+			log.Printf("unable to record run %s: %v\n", run.RunID, err)
+		}
+	}
+
+	if r != nil {
+		panic(r)
+	}
 }
 
 func main() {
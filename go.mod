@@ -6,6 +6,7 @@ require (
 	github.com/aws/aws-lambda-go v1.28.0
 	github.com/aws/aws-sdk-go-v2 v1.13.0
 	github.com/aws/aws-sdk-go-v2/config v1.11.1
+	github.com/aws/aws-sdk-go-v2/credentials v1.6.5
 	github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue v1.4.5
 	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.7.5
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.11.0
@@ -5,144 +5,310 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"io"
 	"net/http"
 	"os"
+	"path"
+	"sort"
 	"strconv"
 	"time"
 )
 
 const (
 	baseAPIURL = "https://epic.gsfc.nasa.gov"
+
+	// defaultCollection is the EPIC image collection queried by the pipeline
+	defaultCollection = "natural"
 )
 
 func NewDateSlice() []*Date {
 	return []*Date{}
 }
 
-func ProcessRecordingDates(dbclient *dynamodb.Client, tableName string, s3client *s3.Client, bucketName string,
-	dates []*Date, startDate time.Time, targetCoordinatesRange map[string]float64) ([]*NasaEpicRecording, error) {
+// ProcessOptions configures which recordings ProcessRecordingDates matches and how they are processed
+type ProcessOptions struct {
+	// StartDate is the earliest recording date processed
+	StartDate time.Time
+	// MaxDates caps the number of dates processed, oldest first. 0 processes every date since StartDate
+	MaxDates int
+
+	RegionName             string
+	TargetCoordinatesRange map[string]float64
+	SolarTimeWindow        *SolarTimeWindow
+	Claim                  ClaimOptions
+	// ChangeDetection, if set, compares each new recording with the previous day's recording of the region
+	ChangeDetection *ChangeDetectionOptions
+
+	// DateCompleted is called, if set, once every matched recording of a date and of every earlier date has been
+	// processed
+	DateCompleted func(date *Date) error
+}
 
-	var nasaRecordsAllMatchedCoordinates []*NasaEpicRecording
+// ProcessRecordingDates processes the matched recordings of every date since opts.StartDate. On error it also
+// returns the recordings written before the error, which must still be reported
+func ProcessRecordingDates(store RecordingStore, objects ObjectStore, dates []*Date, opts ProcessOptions, run *RunRecord) ([]*NasaEpicRecording, error) {
 
-	datesToProcess := AvailableDatesToTarget(dates, startDate)
+	var nasaRecordsAllMatchedCoordinates []*NasaEpicRecording
 
-	for _, recordingDate := range datesToProcess {
+	datesToProcess := AvailableDatesToTarget(dates, opts.StartDate)
 
-		var nasaRecordsForSingleDay []*NasaEpicRecording = nil
+	// oldest first, so that progress is made in order when capped or interrupted
+	sort.Slice(datesToProcess, func(i, j int) bool {
+		return datesToProcess[i].Date.Before(datesToProcess[j].Date)
+	})
+	if opts.MaxDates > 0 && len(datesToProcess) > opts.MaxDates {
+		fmt.Printf("processing the first %d of %d dates to catch up on\n", opts.MaxDates, len(datesToProcess))
+		datesToProcess = datesToProcess[:opts.MaxDates]
+	}
 
-		formattedDate := recordingDate.Date.Format("2006-01-02") // format used in API URI
-		targetURL := baseAPIURL + "/api/natural/date/" + formattedDate
-		fmt.Printf("\nretrieving url: %s\n", targetURL)
+	run.WindowStart = opts.StartDate
+	run.WindowEnd = time.Now().UTC()
+	if len(datesToProcess) > 0 {
+		run.WindowEnd = datesToProcess[len(datesToProcess)-1].Date
+	}
 
-		data, err := GetHTTP(targetURL)
-		if err != nil {
-			return nil, fmt.Errorf("unable to retrieve url %s: %v", targetURL, err)
-		}
+	incomplete := false
+	for _, recordingDate := range datesToProcess {
 
-		err = json.Unmarshal(data, &nasaRecordsForSingleDay)
+		nasaRecordsForSingleDay, err := GetRecordingsForDate(recordingDate.Date)
 		if err != nil {
-			return nil, fmt.Errorf("unable to unmarshal data: %v", err)
+			return nasaRecordsAllMatchedCoordinates, err
 		}
+		run.DatesFetched++
+		run.RecordingsSeen += len(nasaRecordsForSingleDay)
 
-		UpdateDateFieldRecordings(nasaRecordsForSingleDay, "2006-01-02 15:04:05")
+		// local solar time is calculated at the centre of the target region rather than at each centroid
+		regionLongitude := RegionCentreLongitude(opts.TargetCoordinatesRange)
+		SetLocalSolarTime(nasaRecordsForSingleDay, regionLongitude)
 
-		matchedCoordinateResults := QueryRecordingsOnGeoLocation(nasaRecordsForSingleDay, targetCoordinatesRange)
+		matchedCoordinateResults := QueryRecordingsOnGeoLocation(nasaRecordsForSingleDay, opts.TargetCoordinatesRange)
+		matchedCoordinateResults = QueryRecordingsOnLocalSolarTime(matchedCoordinateResults, regionLongitude, opts.SolarTimeWindow)
+		for _, recording := range matchedCoordinateResults {
+			recording.Region = opts.RegionName
+		}
+		run.Matched += len(matchedCoordinateResults)
 
-		newlyDiscoveredRecords, err2 := ProcessRecordings(dbclient, tableName, s3client, bucketName, matchedCoordinateResults, recordingDate)
+		newlyDiscoveredRecords, pending, err2 := ProcessRecordings(store, objects, matchedCoordinateResults, recordingDate, opts.Claim, opts.ChangeDetection, run)
+		nasaRecordsAllMatchedCoordinates = append(nasaRecordsAllMatchedCoordinates, newlyDiscoveredRecords...)
 		if err2 != nil {
-			return nil, fmt.Errorf("problem within the ProcessRecordings function: %v", err2)
+			return nasaRecordsAllMatchedCoordinates, fmt.Errorf("problem within the ProcessRecordings function: %v", err2)
 		}
 
-		nasaRecordsAllMatchedCoordinates = append(nasaRecordsAllMatchedCoordinates, newlyDiscoveredRecords...)
+		// a date is only complete once no recordings are left claimed by another run. Later dates are then not
+		// reported as complete either, so that the pending date is never left behind the watermark
+		if pending > 0 {
+			fmt.Printf("%d recordings on %s are still claimed by another run\n", pending, recordingDate.DateString)
+			incomplete = true
+		} else if incomplete {
+			fmt.Printf("not completing %s as an earlier date is still pending\n", recordingDate.DateString)
+		} else if opts.DateCompleted != nil {
+			err = opts.DateCompleted(recordingDate)
+			if err != nil {
+				return nasaRecordsAllMatchedCoordinates, fmt.Errorf("problem completing date %s: %v", recordingDate.DateString, err)
+			}
+		}
 	}
 
 	return nasaRecordsAllMatchedCoordinates, nil
 }
 
-func ProcessRecordings(dbclient *dynamodb.Client, tableName string, s3client *s3.Client, bucketName string,
-	recordings []*NasaEpicRecording, recordingDate *Date) ([]*NasaEpicRecording, error) {
+// GetRecordingsForDate retrieves the metadata of every recording on a single day from the EPIC API
+func GetRecordingsForDate(date time.Time) ([]*NasaEpicRecording, error) {
+	var recordings []*NasaEpicRecording
 
-	var newlyDiscoveredRecords []*NasaEpicRecording
+	formattedDate := date.Format("2006-01-02") // format used in API URI
+	targetURL := baseAPIURL + "/api/" + defaultCollection + "/date/" + formattedDate
+	fmt.Printf("\nretrieving url: %s\n", targetURL)
+
+	data, err := GetHTTP(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve url %s: %v", targetURL, err)
+	}
 
+	err = json.Unmarshal(data, &recordings)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal data: %v", err)
+	}
+
+	UpdateDateFieldRecordings(recordings, "2006-01-02 15:04:05")
 	for _, recording := range recordings {
+		recording.Collection = defaultCollection
+	}
 
-		dateFormat := "2006-01-02"
-		dateTimeFormat := "2006-01-02 03:04PM"
-		formattedDate := recording.Date.Format(dateFormat)
-		formattedDateTime := recording.Date.Format(dateTimeFormat)
+	return recordings, nil
+}
 
-		// pad month/day to avoid URL issues with single digits
-		paddedMonth := fmt.Sprintf("%02d", recordingDate.Date.Month())
-		paddedDay := fmt.Sprintf("%02d", recordingDate.Date.Day())
+// ProcessRecordings uploads and records every recording not already present in the store. Each recording is
+// claimed before processing and completed straight after, only if the claim is still held, so that overlapping runs
+// never report the same recording twice. The completing writes are not batched, as each is conditional on its own
+// claim, costing a PutItem per new recording on DynamoDB rather than a BatchWriteItem per 25. If changes is set each
+// recording is also compared with the previous day's recording of its region.
+// It also returns the number of recordings left pending under another run's claim
+func ProcessRecordings(store RecordingStore, objects ObjectStore, recordings []*NasaEpicRecording, recordingDate *Date, claim ClaimOptions, changes *ChangeDetectionOptions, run *RunRecord) ([]*NasaEpicRecording, int, error) {
 
-		filename := recording.Image + ".png"
-		downloadDestinationPath := "/tmp/" + filename
-		targetS3KeyName := formattedDate + "/" + filename
+	var newlyDiscoveredRecords []*NasaEpicRecording
+	pending := 0
 
-		imageDownloadLocation := fmt.Sprintf("%s/archive/natural/%d/%s/%s/png/%s",
-			baseAPIURL,
-			recordingDate.Date.Year(),
-			paddedMonth,
-			paddedDay,
-			filename)
+	// check whether the items exist in the DB first already in a single batch and do not download those images
+	keys := make([]RecordKey, len(recordings))
+	for i, recording := range recordings {
+		keys[i] = NewRecordKey(recording.Collection, recording.Identifier, recording.Date)
+	}
 
-		// check whether the item exists in the DB first already and do not download image
-		found, err := CheckIfDBItemExists(dbclient, recording.Identifier, formattedDateTime, tableName)
-		if err != nil {
-			return nil, fmt.Errorf("unable to check if item already exists in DB: %v", err)
+	found, err := store.ExistsBatch(keys)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to check if items already exist in DB: %v", err)
+	}
+
+	var processingErr error
+	for i, recording := range recordings {
+		if found[keys[i]] {
+			fmt.Printf("Skipping as item %s already present in database\n", recording.Identifier)
+			run.Skipped++
+			continue
 		}
 
-		if !found {
-			// download the image locally from the nasa server first
-			size, err2 := DownloadImage(imageDownloadLocation, downloadDestinationPath)
-			if err2 != nil {
-				return nil, fmt.Errorf("unable to download image %s: %v", downloadDestinationPath, err2)
-			}
+		claimed, err2 := store.Claim(keys[i], claim.Owner, time.Now().Add(claim.Lease))
+		if err2 != nil {
+			processingErr = fmt.Errorf("unable to claim item %s: %v", recording.Identifier, err2)
+			break
+		}
+		if !claimed {
+			fmt.Printf("Skipping as item %s has been claimed by another run\n", recording.Identifier)
+			run.Skipped++
+			pending++
+			continue
+		}
 
-			// upload to S3
-			file, err3 := os.Open(downloadDestinationPath)
-			if err3 != nil {
-				return nil, fmt.Errorf("unable to open file %s: %v", downloadDestinationPath, err3)
-			}
+		record, err3 := processRecording(objects, recording, recordingDate)
+		if err3 != nil {
+			processingErr = err3
+			break
+		}
 
-			s3Location, err4 := UploadS3Object(s3client, file, bucketName, targetS3KeyName, "image/png")
+		// a failed comparison is reported but does not stop the recording being stored
+		if changes != nil {
+			change, err4 := DetectChange(store, objects, &record, *changes)
 			if err4 != nil {
-				return nil, fmt.Errorf("unable to upload file to S3: %v", err4)
+				fmt.Printf("Unable to detect change for item %s: %v\n", recording.Identifier, err4)
+			} else if change != nil {
+				fmt.Printf("Item %s changed by %s since %s (flagged: %t)\n",
+					recording.Identifier, change.Percentage(), change.PreviousRecordID, change.Flagged)
+				record.Change = change
+				recording.Change = change
 			}
+		}
 
-			// close and then clean up local copy of file
-			err5 := file.Close()
-			if err5 != nil {
-				return nil, fmt.Errorf("unable to close file %s: %v", downloadDestinationPath, err5)
-			}
-			err = os.Remove(downloadDestinationPath)
-			if err != nil {
-				return nil, fmt.Errorf("unable to remove local copy of file %s", downloadDestinationPath)
-			}
+		// each claim is completed as soon as its recording is processed. If our lease ran out and another run took
+		// over the claim, the recording is left to that run to complete and report
+		completed, err3 := store.Complete(record, claim.Owner)
+		if err3 != nil {
+			processingErr = fmt.Errorf("error writing item %s to database: %v", recording.Identifier, err3)
+			break
+		}
+		if !completed {
+			fmt.Printf("Skipping completion of item %s as its claim has been taken over by another run\n", recording.Identifier)
+			run.Skipped++
+			pending++
+			continue
+		}
 
-			// update struct with additional information required for later HTML templating to S3 bucket
-			recording.S3Location = s3Location
-			recording.FormattedDateStr = formattedDateTime
-			recording.ImageSize = size
+		run.Uploaded++
+		run.BytesTransferred += record.ImageSize
+		newlyDiscoveredRecords = append(newlyDiscoveredRecords, recording)
+	}
 
-			// write to database after completing successfully
-			record := CreateDBRecordType(recording.Identifier, formattedDateTime, s3Location, size, recording.Date)
-			err = WriteDBItem(dbclient, record, tableName)
-			if err != nil {
-				return nil, fmt.Errorf("error writing record '%v' to database: %v", record, err)
-			}
+	// the recordings written before an error are returned with it so that they are still reported, as later runs
+	// skip them as already present
+	return newlyDiscoveredRecords, pending, processingErr
+}
 
-			// append to return results
-			newlyDiscoveredRecords = append(newlyDiscoveredRecords, recording)
+// processRecording downloads the image of a single recording, uploads it to the object store and returns the
+// DBRecord to store
+func processRecording(objects ObjectStore, recording *NasaEpicRecording, recordingDate *Date) (DBRecord, error) {
 
-		} else {
-			fmt.Printf("Skipping as item %s already present in database\n", recording.Identifier)
-		}
+	dateFormat := "2006-01-02"
+	dateTimeFormat := "2006-01-02 03:04PM"
+	formattedDate := recording.Date.Format(dateFormat)
+	formattedDateTime := recording.Date.Format(dateTimeFormat)
+
+	targetS3KeyName := formattedDate + "/" + recording.Image + ".png"
+	imageDownloadLocation := archiveImageURL(defaultCollection, recordingDate.Date, recording.Image)
+
+	s3Location, size, md5Hash, err := transferArchiveImage(objects, imageDownloadLocation, targetS3KeyName)
+	if err != nil {
+		return DBRecord{}, err
+	}
+
+	// update struct with additional information required for later HTML templating to S3 bucket
+	recording.S3Location = s3Location
+	recording.S3Key = targetS3KeyName
+	recording.FormattedDateStr = formattedDateTime
+	recording.ImageSize = size
+	recording.ImageMD5 = md5Hash
+
+	return CreateDBRecordType(recording), nil
+}
+
+// archiveImageURL returns the URL of the full resolution PNG of an image in the EPIC archive
+func archiveImageURL(collection string, date time.Time, image string) string {
+	// pad month/day to avoid URL issues with single digits
+	paddedMonth := fmt.Sprintf("%02d", date.Month())
+	paddedDay := fmt.Sprintf("%02d", date.Day())
+
+	return fmt.Sprintf("%s/archive/%s/%d/%s/%s/png/%s.png",
+		baseAPIURL,
+		collection,
+		date.Year(),
+		paddedMonth,
+		paddedDay,
+		image)
+}
+
+// archiveThumbnailURL returns the URL of the JPEG thumbnail of an image in the EPIC archive
+func archiveThumbnailURL(collection string, date time.Time, image string) string {
+	return fmt.Sprintf("%s/archive/%s/%s/thumbs/%s.jpg", baseAPIURL, collection, date.Format("2006/01/02"), image)
+}
+
+// transferArchiveImage downloads an image from the EPIC archive and uploads it to targetKey. It returns the public
+// URL, size and hex MD5 hash of the uploaded image
+func transferArchiveImage(objects ObjectStore, imageURL, targetKey string) (string, int64, string, error) {
+	downloadDestinationPath := "/tmp/" + path.Base(targetKey)
+
+	// download the image locally from the nasa server first
+	size, err := DownloadImage(imageURL, downloadDestinationPath)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("unable to download image %s: %v", downloadDestinationPath, err)
+	}
+
+	md5Hash, err := hashFile(downloadDestinationPath)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("unable to hash image %s: %v", downloadDestinationPath, err)
+	}
+
+	// upload to the object store
+	file, err2 := os.Open(downloadDestinationPath)
+	if err2 != nil {
+		return "", 0, "", fmt.Errorf("unable to open file %s: %v", downloadDestinationPath, err2)
+	}
+
+	s3Location, err3 := objects.Put(targetKey, file, "image/png", CacheControlStable)
+	if err3 != nil {
+		file.Close()
+		return "", 0, "", fmt.Errorf("unable to upload file to object store: %v", err3)
+	}
+
+	// close and then clean up local copy of file
+	err = file.Close()
+	if err != nil {
+		return "", 0, "", fmt.Errorf("unable to close file %s: %v", downloadDestinationPath, err)
 	}
-	return newlyDiscoveredRecords, nil
+	err = os.Remove(downloadDestinationPath)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("unable to remove local copy of file %s", downloadDestinationPath)
+	}
+
+	return s3Location, size, md5Hash, nil
 }
 
 func ConvertRawStringToDateTime(raw, format string) time.Time {
@@ -304,7 +470,7 @@ func DownloadImage(url, destination string) (int64, error) {
 //}
 
 func GetAllAvailableDates() ([]byte, error) {
-	data, err := GetHTTP(baseAPIURL + "/api/natural/all")
+	data, err := GetHTTP(baseAPIURL + "/api/" + defaultCollection + "/all")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,56 @@
+package nasa_epic_api
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// AWSClientConfig configures how a single AWS client connects. Zero values fall back to the SDK defaults, so only
+// the region is needed against AWS itself. The other settings point a client at a compatible stand-in such as
+// MinIO or DynamoDB Local
+type AWSClientConfig struct {
+	Region string
+	// EndpointURL replaces the AWS endpoint of the service
+	EndpointURL string
+	// AccessKeyID and SecretAccessKey, if set, are used in place of the default credential chain
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// UsePathStyle addresses S3 buckets in the URL path rather than the host name. Only used by S3 clients
+	UsePathStyle bool
+}
+
+// loadAWSConfig returns the shared SDK configuration for cfg. Endpoints are set per service by each client
+func loadAWSConfig(cfg AWSClientConfig) (aws.Config, error) {
+	var optFns []func(*config.LoadOptions) error
+	if cfg.Region != "" {
+		optFns = append(optFns, config.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKeyID != "" {
+		optFns = append(optFns, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken)))
+	}
+
+	return config.LoadDefaultConfig(context.TODO(), optFns...)
+}
+
+// credentialsExpiry returns when the credentials cfg signs requests with expire, or the zero time if they do not
+func credentialsExpiry(cfg AWSClientConfig) (time.Time, error) {
+	awsConfig, err := loadAWSConfig(cfg)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	credentials, err := awsConfig.Credentials.Retrieve(context.TODO())
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !credentials.CanExpire {
+		return time.Time{}, nil
+	}
+	return credentials.Expires, nil
+}
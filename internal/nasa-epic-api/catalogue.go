@@ -0,0 +1,240 @@
+package nasa_epic_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// CatalogueVersion is the version of the JSON catalogue format. It is bumped, and the catalogue published under
+	// a new prefix, whenever a change would break existing consumers
+	CatalogueVersion = 1
+)
+
+// cataloguePrefix is the key prefix of every object of the current catalogue version
+var cataloguePrefix = fmt.Sprintf("catalogue/v%d/", CatalogueVersion)
+
+// catalogueRoot is the path from the catalogue's documents back to the root of the site
+const catalogueRoot = "../../"
+
+// CatalogueManifest is the top level document of the catalogue, listing its monthly shards
+type CatalogueManifest struct {
+	Version int `json:"version"`
+	// Updated is the time of the most recent recording
+	Updated     time.Time           `json:"updated"`
+	RecordCount int                 `json:"record_count"`
+	Regions     []CatalogueRegion   `json:"regions"`
+	Shards      []CatalogueShardRef `json:"shards"`
+}
+
+// CatalogueRegion is the number of recordings matched by a watch region
+type CatalogueRegion struct {
+	Name        string `json:"name"`
+	RecordCount int    `json:"record_count"`
+}
+
+// CatalogueShardRef locates the shard holding a single month of recordings
+type CatalogueShardRef struct {
+	Month       string `json:"month"`
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+	RecordCount int    `json:"record_count"`
+}
+
+// CatalogueShard holds the recordings of a single month, oldest first
+type CatalogueShard struct {
+	Version    int                  `json:"version"`
+	Month      string               `json:"month"`
+	Recordings []CatalogueRecording `json:"recordings"`
+}
+
+// CatalogueRecording is the published form of a DBRecord
+type CatalogueRecording struct {
+	RecordID       string                `json:"record_id"`
+	Identifier     string                `json:"identifier"`
+	Collection     string                `json:"collection"`
+	Date           time.Time             `json:"date"`
+	LocalSolarTime string                `json:"local_solar_time,omitempty"`
+	Region         string                `json:"region,omitempty"`
+	Caption        string                `json:"caption,omitempty"`
+	Image          string                `json:"image,omitempty"`
+	Version        string                `json:"version,omitempty"`
+	Centroid       *CatalogueCoordinates `json:"centroid,omitempty"`
+	DscovrPosition *CataloguePosition    `json:"dscovr_j2000_position,omitempty"`
+	LunarPosition  *CataloguePosition    `json:"lunar_j2000_position,omitempty"`
+	SunPosition    *CataloguePosition    `json:"sun_j2000_position,omitempty"`
+	ImageSize      int64                 `json:"image_size"`
+	ImageMD5       string                `json:"image_md5,omitempty"`
+	ImageURL       string                `json:"image_url"`
+	PageURL        string                `json:"page_url"`
+	ArchiveURL     string                `json:"archive_url,omitempty"`
+	Change         *CatalogueChange      `json:"change,omitempty"`
+}
+
+// CatalogueChange is the change detected since the previous day's recording of the same region
+type CatalogueChange struct {
+	PreviousRecordID string  `json:"previous_record_id"`
+	Score            float64 `json:"score"`
+	Flagged          bool    `json:"flagged"`
+	DiffURL          string  `json:"diff_url"`
+}
+
+type CatalogueCoordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// CataloguePosition is a J2000 position vector in kilometres
+type CataloguePosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// PublishCatalogue publishes every record as a JSON catalogue: a manifest at catalogue/v1/manifest.json and one
+// shard per month at catalogue/v1/2006-01.json. As with the gallery, unchanged objects are not uploaded again and
+// shards of months without records are deleted. It returns the keys of the objects which were uploaded or deleted
+func PublishCatalogue(records []*DBRecord, objects ObjectStore) ([]string, error) {
+	existing, err := existingObjectHashes(objects, cataloguePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]*DBRecord, len(records))
+	copy(sorted, records)
+	SortRecordsByDate(sorted)
+
+	manifest := CatalogueManifest{Version: CatalogueVersion, RecordCount: len(sorted)}
+	shards := map[string]*CatalogueShard{}
+	regionCounts := map[string]int{}
+
+	for _, record := range sorted {
+		month := record.Date.UTC().Format(datePartitionFormat)
+		shard, found := shards[month]
+		if !found {
+			shard = &CatalogueShard{Version: CatalogueVersion, Month: month}
+			shards[month] = shard
+		}
+		shard.Recordings = append(shard.Recordings, newCatalogueRecording(record, objects))
+
+		if record.Region != "" {
+			regionCounts[record.Region]++
+		}
+		manifest.Updated = record.Date.UTC()
+	}
+
+	for name, count := range regionCounts {
+		manifest.Regions = append(manifest.Regions, CatalogueRegion{Name: name, RecordCount: count})
+	}
+	sort.Slice(manifest.Regions, func(i, j int) bool {
+		return manifest.Regions[i].Name < manifest.Regions[j].Name
+	})
+
+	var changed []string
+	generated := map[string]bool{}
+	publish := func(key string, document interface{}) error {
+		body, err2 := json.MarshalIndent(document, "", "  ")
+		if err2 != nil {
+			return fmt.Errorf("unable to marshal %s: %v", key, err2)
+		}
+		generated[key] = true
+
+		published, err2 := publishIfChanged(objects, existing, key, body, "application/json", CacheControlShort)
+		if err2 != nil {
+			return fmt.Errorf("unable to upload %s to object store: %v", key, err2)
+		}
+		if published {
+			changed = append(changed, key)
+		}
+		return nil
+	}
+
+	var months []string
+	for month := range shards {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+
+	for _, month := range months {
+		key := cataloguePrefix + month + ".json"
+		err = publish(key, shards[month])
+		if err != nil {
+			return nil, err
+		}
+		manifest.Shards = append(manifest.Shards, CatalogueShardRef{
+			Month:       month,
+			Key:         key,
+			URL:         catalogueURL(objects, key),
+			RecordCount: len(shards[month].Recordings),
+		})
+	}
+
+	// the manifest is written last so that it never lists a shard which has not been published
+	err = publish(cataloguePrefix+"manifest.json", manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range existing {
+		if generated[key] || !strings.HasPrefix(key, cataloguePrefix) {
+			continue
+		}
+		err = objects.Delete(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to delete stale catalogue shard %s: %v", key, err)
+		}
+		changed = append(changed, key)
+	}
+
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// newCatalogueRecording returns the catalogue entry of record. Metadata missing from records written before it was
+// stored is omitted rather than published as zero values
+func newCatalogueRecording(record *DBRecord, objects ObjectStore) CatalogueRecording {
+	collection, identifier := splitRecordID(record.Key().RecordID)
+
+	recording := CatalogueRecording{
+		RecordID:       record.Key().RecordID,
+		Identifier:     identifier,
+		Collection:     collection,
+		Date:           record.Date.UTC(),
+		LocalSolarTime: record.LocalSolarTime,
+		Region:         record.Region,
+		Caption:        record.Caption,
+		Image:          record.Image,
+		Version:        record.Version,
+		ImageSize:      record.ImageSize,
+		ImageMD5:       record.ImageMD5,
+		ImageURL:       relativeLink(catalogueRoot, recordImageURL(record, objects)),
+		PageURL:        catalogueURL(objects, record.PageKey()),
+		ArchiveURL:     record.ArchiveURL(),
+	}
+	if record.Change != nil {
+		recording.Change = &CatalogueChange{
+			PreviousRecordID: record.Change.PreviousRecordID,
+			Score:            record.Change.Score,
+			Flagged:          record.Change.Flagged,
+			DiffURL:          catalogueURL(objects, record.Change.DiffKey),
+		}
+	}
+	if record.SchemaVersion >= 1 {
+		recording.Centroid = &CatalogueCoordinates{Lat: record.CentroidCoordinates.Lat, Lon: record.CentroidCoordinates.Lon}
+		recording.DscovrPosition = (*CataloguePosition)(&record.DscovrPosition)
+		recording.LunarPosition = (*CataloguePosition)(&record.LunarPosition)
+		recording.SunPosition = (*CataloguePosition)(&record.SunPosition)
+	}
+
+	return recording
+}
+
+// catalogueURL returns the URL of an object linked from the catalogue. Without a base URL the object store returns
+// keys relative to the root of the site, which are linked relative to the catalogue's documents instead
+func catalogueURL(objects ObjectStore, key string) string {
+	return relativeLink(catalogueRoot, objects.PublicURL(key))
+}
@@ -0,0 +1,79 @@
+package nasa_epic_api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// readCatalogueDocument decodes the published catalogue document at key into document
+func readCatalogueDocument(t *testing.T, objects ObjectStore, key string, document interface{}) {
+	body, err := objects.Get(key)
+	if err != nil {
+		t.Fatalf("unable to read %s: %v", key, err)
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(data, document)
+	if err != nil {
+		t.Fatalf("unable to decode %s: %v", key, err)
+	}
+}
+
+func TestPublishCatalogueLinksResolveWithoutBaseURL(t *testing.T) {
+	objects := NewFileObjectStore(t.TempDir(), "")
+
+	record := testRecord("20230101003633", time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC))
+	record.S3Key = "2023-01-01/epic_1b_20230101003633.png"
+	record.S3Location = objects.PublicURL(record.S3Key)
+	record.Change = &ChangeResult{PreviousRecordID: "natural#20221231003633", DiffKey: record.DiffKey()}
+
+	_, err := PublishCatalogue([]*DBRecord{&record}, objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	site, _ := url.Parse("https://example.com/site/")
+	resolve := func(from, link string) string {
+		ref, err2 := url.Parse(link)
+		if err2 != nil {
+			t.Fatalf("invalid link %s: %v", link, err2)
+		}
+		return site.ResolveReference(&url.URL{Path: from}).ResolveReference(ref).String()
+	}
+
+	manifestKey := cataloguePrefix + "manifest.json"
+	var manifest CatalogueManifest
+	readCatalogueDocument(t, objects, manifestKey, &manifest)
+
+	if len(manifest.Shards) != 1 {
+		t.Fatalf("expected 1 shard, got %d", len(manifest.Shards))
+	}
+	shard := manifest.Shards[0]
+	if got, want := resolve(manifestKey, shard.URL), site.String()+shard.Key; got != want {
+		t.Errorf("shard URL %s resolves to %s, expected %s", shard.URL, got, want)
+	}
+
+	var shardDocument CatalogueShard
+	readCatalogueDocument(t, objects, shard.Key, &shardDocument)
+
+	recording := shardDocument.Recordings[0]
+	links := []struct {
+		name, link, key string
+	}{
+		{"page", recording.PageURL, record.PageKey()},
+		{"image", recording.ImageURL, record.S3Key},
+		{"diff", recording.Change.DiffURL, record.Change.DiffKey},
+	}
+	for _, l := range links {
+		if got, want := resolve(shard.Key, l.link), site.String()+l.key; got != want {
+			t.Errorf("%s URL %s resolves to %s, expected %s", l.name, l.link, got, want)
+		}
+	}
+}
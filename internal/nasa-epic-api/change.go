@@ -0,0 +1,162 @@
+package nasa_epic_api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"time"
+)
+
+const (
+	// changePrefix is the key prefix of every diff image
+	changePrefix = "changes/"
+	// changeDetectionWidth is the width in pixels both crops are scaled to before they are compared
+	changeDetectionWidth = 320
+
+	// DefaultChangeThreshold is the difference score at or above which a change is flagged when not configured
+	DefaultChangeThreshold = 0.1
+)
+
+// ChangeDetectionOptions configures the comparison of each new recording with the previous day's recording of the
+// same region and collection
+type ChangeDetectionOptions struct {
+	// Coordinates is the target coordinates range of the region, used to crop both recordings
+	Coordinates map[string]float64
+	// Threshold is the difference score, between 0 and 1, at or above which a change is flagged
+	Threshold float64
+}
+
+// ChangeResult is the outcome of comparing a recording's region crop with the previous day's
+type ChangeResult struct {
+	// PreviousRecordID is the RecordID of the recording compared against
+	PreviousRecordID string
+	// Score is the mean absolute difference of the two crops, from 0 for identical crops to 1
+	Score   float64
+	Flagged bool
+	// DiffKey is the object key of the diff visualisation
+	DiffKey string
+}
+
+// Percentage returns the score as a percentage for display, e.g. 12.5%
+func (c *ChangeResult) Percentage() string {
+	return fmt.Sprintf("%.1f%%", c.Score*100)
+}
+
+// DiffKey returns the key of the diff visualisation of a record, e.g. changes/natural/20230101003633.png
+func (r *DBRecord) DiffKey() string {
+	collection, identifier := splitRecordID(r.Key().RecordID)
+	return fmt.Sprintf("%s%s/%s.png", changePrefix, collection, identifier)
+}
+
+// DetectChange compares the region crop of record with that of the previous day's recording of the same region and
+// collection, taken closest to 24 hours earlier, and uploads a diff visualisation of the two. It returns nil if
+// there is no previous recording to compare against
+func DetectChange(store RecordingStore, objects ObjectStore, record *DBRecord, opts ChangeDetectionOptions) (*ChangeResult, error) {
+	previous, err := previousDayRecord(store, record)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return nil, nil
+	}
+
+	// the region falls differently on each day's disc, so both are projected onto the same grid before comparing
+	cropper := newRegionCropper(opts.Coordinates)
+	current, err := cropper.LoadProjected(objects, record, changeDetectionWidth)
+	if err != nil {
+		return nil, err
+	}
+	before, err := cropper.LoadProjected(objects, previous, changeDetectionWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	score, diff := compareImages(before, current)
+
+	result := &ChangeResult{
+		PreviousRecordID: previous.Key().RecordID,
+		Score:            score,
+		Flagged:          score >= opts.Threshold,
+		DiffKey:          record.DiffKey(),
+	}
+
+	var body bytes.Buffer
+	err = png.Encode(&body, diff)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode diff image %s: %v", result.DiffKey, err)
+	}
+	_, err = objects.Put(result.DiffKey, &body, "image/png", CacheControlStable)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload diff image %s to object store: %v", result.DiffKey, err)
+	}
+
+	return result, nil
+}
+
+// previousDayRecord returns the recording of the same region and collection on the day before record which was
+// taken closest to 24 hours earlier, so that the region is lit in the same way, or nil if there is none
+func previousDayRecord(store RecordingStore, record *DBRecord) (*DBRecord, error) {
+	// a single day is read through the date range index rather than listing every record
+	day := record.Date.UTC().Truncate(24 * time.Hour)
+	candidates, err := store.QueryByDateRange(day.AddDate(0, 0, -1), day.Add(-time.Nanosecond))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the previous day's records of region %s: %v", record.Region, err)
+	}
+
+	collection, _ := splitRecordID(record.Key().RecordID)
+	target := record.Date.Add(-24 * time.Hour)
+
+	filter := RecordingFilter{Region: record.Region}
+	var closest *DBRecord
+	for _, candidate := range candidates {
+		candidateCollection, _ := splitRecordID(candidate.Key().RecordID)
+		if candidateCollection != collection || !filter.Matches(candidate) {
+			continue
+		}
+		if closest == nil || absDuration(candidate.Date.Sub(target)) < absDuration(closest.Date.Sub(target)) {
+			closest = candidate
+		}
+	}
+
+	return closest, nil
+}
+
+// compareImages returns the mean absolute difference of two images of the same size, from 0 to 1, and a
+// visualisation of the difference: the newer image in greyscale with changed pixels highlighted in red
+func compareImages(before, after *image.RGBA) (float64, *image.RGBA) {
+	bounds := after.Bounds()
+	diff := image.NewRGBA(bounds)
+
+	var total float64
+	for i := 0; i+3 < len(after.Pix); i += 4 {
+		var delta float64
+		for c := 0; c < 3; c++ {
+			delta += math.Abs(float64(after.Pix[i+c]) - float64(before.Pix[i+c]))
+		}
+		delta /= 3 * 255
+		total += delta
+
+		grey := (0.299*float64(after.Pix[i]) + 0.587*float64(after.Pix[i+1]) + 0.114*float64(after.Pix[i+2])) / 2
+		// small differences are amplified so that they remain visible
+		highlight := math.Min(1, delta*4)
+		diff.Pix[i] = uint8(grey + (255-grey)*highlight)
+		diff.Pix[i+1] = uint8(grey * (1 - highlight))
+		diff.Pix[i+2] = uint8(grey * (1 - highlight))
+		diff.Pix[i+3] = 0xff
+	}
+
+	pixels := bounds.Dx() * bounds.Dy()
+	if pixels == 0 {
+		return 0, diff
+	}
+	return total / float64(pixels), diff
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,66 @@
+package nasa_epic_api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	RecordStatusInProgress = "in_progress"
+	RecordStatusCompleted  = "completed"
+)
+
+// ClaimOptions identifies the run claiming recordings and how long its claims are held for
+type ClaimOptions struct {
+	Owner string
+	Lease time.Duration
+}
+
+// NewRunID returns a unique identifier for a single invocation of the pipeline
+func NewRunID() string {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("unable to generate run ID: %v", err))
+	}
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(b))
+}
+
+// IsCompleted reports whether the record has finished processing. Records written before claims were
+// introduced have no status and are treated as completed
+func (r *DBRecord) IsCompleted() bool {
+	return r.Status == "" || r.Status == RecordStatusCompleted
+}
+
+// IsClaimable reports whether the record is an in-progress claim whose lease has expired
+func (r *DBRecord) IsClaimable(now time.Time) bool {
+	return r.Status == RecordStatusInProgress && r.LeaseExpiry < now.Unix()
+}
+
+// newClaimRecord returns the placeholder record written when a recording is claimed
+func newClaimRecord(key RecordKey, owner string, leaseExpiry time.Time) DBRecord {
+	return DBRecord{
+		RecordID:    key.RecordID,
+		Timestamp:   key.Timestamp,
+		Identifier:  key.Identifier(),
+		Status:      RecordStatusInProgress,
+		ClaimOwner:  owner,
+		LeaseExpiry: leaseExpiry.Unix(),
+	}
+}
+
+// completedRecord returns record marked as completed by owner, as written by RecordingStore.Complete
+func completedRecord(record DBRecord, owner string) DBRecord {
+	record.Status = RecordStatusCompleted
+	record.ClaimOwner = owner
+	record.LeaseExpiry = 0
+	return record
+}
+
+// isClaimedBy reports whether the record is an in-progress claim held by owner. The lease itself is not checked,
+// as an expired claim which no other run has taken over can still be completed by its owner
+func (r *DBRecord) isClaimedBy(owner string) bool {
+	return r.Status == RecordStatusInProgress && r.ClaimOwner == owner
+}
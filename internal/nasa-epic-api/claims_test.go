@@ -0,0 +1,100 @@
+package nasa_epic_api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimIsExclusiveUntilLeaseExpires(t *testing.T) {
+	store := NewMemoryRecordingStore()
+	key := NewRecordKey(defaultCollection, "a", time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC))
+
+	claimed, err := store.Claim(key, "run-1", time.Now().Add(time.Hour))
+	if err != nil || !claimed {
+		t.Fatalf("expected the first claim to succeed, got %t, %v", claimed, err)
+	}
+
+	claimed, err = store.Claim(key, "run-2", time.Now().Add(time.Hour))
+	if err != nil || claimed {
+		t.Fatalf("expected a claim under an unexpired lease to fail, got %t, %v", claimed, err)
+	}
+
+	exists, _ := store.Exists(key)
+	if exists {
+		t.Errorf("expected an in-progress claim to be reported as not present")
+	}
+}
+
+func TestClaimTakeoverAfterLeaseExpiry(t *testing.T) {
+	store := NewMemoryRecordingStore()
+	record := testRecord("a", time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC))
+	key := record.Key()
+
+	claimed, err := store.Claim(key, "run-1", time.Now().Add(-time.Second))
+	if err != nil || !claimed {
+		t.Fatalf("expected the first claim to succeed, got %t, %v", claimed, err)
+	}
+
+	claimed, err = store.Claim(key, "run-2", time.Now().Add(time.Hour))
+	if err != nil || !claimed {
+		t.Fatalf("expected an expired claim to be taken over, got %t, %v", claimed, err)
+	}
+
+	// the run whose lease expired must not overwrite the claim now held by another run
+	completed, err := store.Complete(record, "run-1")
+	if err != nil || completed {
+		t.Fatalf("expected completing a claim taken over by another run to fail, got %t, %v", completed, err)
+	}
+
+	stored, _ := store.Get(key)
+	if stored.Status != RecordStatusInProgress || stored.ClaimOwner != "run-2" {
+		t.Errorf("expected the claim of run-2 to be left in place, got %s by %s", stored.Status, stored.ClaimOwner)
+	}
+
+	completed, err = store.Complete(record, "run-2")
+	if err != nil || !completed {
+		t.Fatalf("expected the run holding the claim to complete it, got %t, %v", completed, err)
+	}
+
+	exists, _ := store.Exists(key)
+	if !exists {
+		t.Errorf("expected the completed record to be present")
+	}
+
+	// a completed recording can never be claimed again, however its claim ended
+	claimed, err = store.Claim(key, "run-3", time.Now().Add(time.Hour))
+	if err != nil || claimed {
+		t.Errorf("expected a completed record not to be claimable, got %t, %v", claimed, err)
+	}
+}
+
+func TestCompleteExpiredClaimNotTakenOver(t *testing.T) {
+	store := NewMemoryRecordingStore()
+	record := testRecord("a", time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC))
+
+	_, err := store.Claim(record.Key(), "run-1", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lease has run out, but no other run has taken over the claim
+	completed, err := store.Complete(record, "run-1")
+	if err != nil || !completed {
+		t.Fatalf("expected an expired claim still held by its owner to be completed, got %t, %v", completed, err)
+	}
+
+	stored, _ := store.Get(record.Key())
+	if !stored.IsCompleted() || stored.LeaseExpiry != 0 {
+		t.Errorf("expected a completed record without a lease, got %s expiring %d", stored.Status, stored.LeaseExpiry)
+	}
+}
+
+func TestCompleteWithoutClaim(t *testing.T) {
+	store := NewMemoryRecordingStore()
+	record := testRecord("a", time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC))
+
+	completed, err := store.Complete(record, "run-1")
+	if err != nil || completed {
+		t.Fatalf("expected completing an unclaimed recording to fail, got %t, %v", completed, err)
+	}
+}
@@ -0,0 +1,219 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const (
+	// epicFieldOfView is the angular width in degrees of an EPIC image
+	epicFieldOfView = 0.62
+	earthRadiusKm   = 6371.0
+	// defaultDscovrDistanceKm is used for records written before the DSCOVR position was stored
+	defaultDscovrDistanceKm = 1.5e6
+)
+
+// regionCropper projects a watch region onto full disc EPIC images and resamples the area it covers. The images
+// are orthographic projections of the Earth centred on the recording's centroid coordinates, with north up
+type regionCropper struct {
+	coordinates map[string]float64
+}
+
+func newRegionCropper(coordinates map[string]float64) *regionCropper {
+	return &regionCropper{coordinates: coordinates}
+}
+
+// LoadProjected reads the record's image from the object store and returns the region projected as by Project
+func (c *regionCropper) LoadProjected(objects ObjectStore, record *DBRecord, width int) (*image.RGBA, error) {
+	img, err := loadRecordImage(objects, record)
+	if err != nil {
+		return nil, err
+	}
+	return c.Project(img, record, width)
+}
+
+// loadRecordImage reads and decodes the full disc image of a record
+func loadRecordImage(objects ObjectStore, record *DBRecord) (image.Image, error) {
+	key := record.ObjectKey()
+	if key == "" {
+		return nil, fmt.Errorf("record %s has no image", record.Key().RecordID)
+	}
+
+	body, err := objects.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image %s: %v", key, err)
+	}
+	defer body.Close()
+
+	img, err := png.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image %s: %v", key, err)
+	}
+
+	return img, nil
+}
+
+// Project resamples the region of img onto a fixed latitude and longitude grid width pixels wide, so that the region
+// is framed identically in every recording however it falls on the disc. Longitudes are scaled by the cosine of the
+// region's central latitude to keep its proportions. Parts of the region on the far side of the Earth are black
+func (c *regionCropper) Project(img image.Image, record *DBRecord, width int) (*image.RGBA, error) {
+	bounds := img.Bounds()
+	centreX := float64(bounds.Min.X) + float64(bounds.Dx())/2
+	centreY := float64(bounds.Min.Y) + float64(bounds.Dy())/2
+	radius := earthDiscRadius(record, bounds.Dx())
+
+	latMin, latMax := c.coordinates["latMin"], c.coordinates["latMax"]
+	lonMin, lonMax := c.coordinates["lonMin"], c.coordinates["lonMax"]
+	height := c.projectedHeight(width)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	visible := false
+	for y := 0; y < height; y++ {
+		// rows count down from the north edge of the region
+		lat := latMax - (latMax-latMin)*(float64(y)+0.5)/float64(height)
+		for x := 0; x < width; x++ {
+			lon := lonMin + (lonMax-lonMin)*(float64(x)+0.5)/float64(width)
+			px, py, onDisc := orthographicProjection(lat, lon, record.CentroidCoordinates)
+			if !onDisc {
+				dst.Set(x, y, color.Black)
+				continue
+			}
+			visible = true
+			dst.Set(x, y, bilinearSample(img, centreX+px*radius-0.5, centreY-py*radius-0.5))
+		}
+	}
+	if !visible {
+		return nil, fmt.Errorf("region is not visible in record %s", record.Key().RecordID)
+	}
+
+	return dst, nil
+}
+
+// projectedHeight returns the height of the region projected width pixels wide
+func (c *regionCropper) projectedHeight(width int) int {
+	latMin, latMax := c.coordinates["latMin"], c.coordinates["latMax"]
+	lonMin, lonMax := c.coordinates["lonMin"], c.coordinates["lonMax"]
+
+	lonSpan := (lonMax - lonMin) * math.Cos((latMin+latMax)/2*math.Pi/180)
+	if lonSpan <= 0 {
+		return width
+	}
+	height := int(math.Round(float64(width) * (latMax - latMin) / lonSpan))
+	if height < 1 {
+		return 1
+	}
+	return height
+}
+
+// bilinearSample returns the colour of img at the fractional pixel position x, y, where whole numbers are pixel
+// centres. Positions outside of img are clamped to its edge
+func bilinearSample(img image.Image, x, y float64) color.Color {
+	bounds := img.Bounds()
+	clamp := func(v, min, max int) int {
+		if v < min {
+			return min
+		}
+		if v >= max {
+			return max - 1
+		}
+		return v
+	}
+
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+
+	var channels [4]float64
+	for _, corner := range []struct {
+		dx, dy int
+		weight float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		sx := clamp(int(x0)+corner.dx, bounds.Min.X, bounds.Max.X)
+		sy := clamp(int(y0)+corner.dy, bounds.Min.Y, bounds.Max.Y)
+		r, g, b, a := img.At(sx, sy).RGBA()
+		channels[0] += float64(r) * corner.weight
+		channels[1] += float64(g) * corner.weight
+		channels[2] += float64(b) * corner.weight
+		channels[3] += float64(a) * corner.weight
+	}
+
+	return color.RGBA64{R: uint16(channels[0]), G: uint16(channels[1]), B: uint16(channels[2]), A: uint16(channels[3])}
+}
+
+// earthDiscRadius returns the radius in pixels of the Earth in an image width pixels wide, from the distance of
+// DSCOVR at the time of the recording
+func earthDiscRadius(record *DBRecord, width int) float64 {
+	distance := record.DscovrPosition.Magnitude()
+	if distance <= earthRadiusKm {
+		distance = defaultDscovrDistanceKm
+	}
+	halfFieldOfView := epicFieldOfView / 2 * math.Pi / 180
+	return math.Tan(math.Asin(earthRadiusKm/distance)) / math.Tan(halfFieldOfView) * float64(width) / 2
+}
+
+// orthographicProjection projects a point onto the disc of the Earth seen from above centre, in Earth radii east
+// and north of the centre of the disc. Points on the far side of the Earth are not visible
+func orthographicProjection(lat, lon float64, centre Coordinates) (float64, float64, bool) {
+	phi, lambda := lat*math.Pi/180, lon*math.Pi/180
+	phi0, lambda0 := centre.Lat*math.Pi/180, centre.Lon*math.Pi/180
+
+	cosC := math.Sin(phi0)*math.Sin(phi) + math.Cos(phi0)*math.Cos(phi)*math.Cos(lambda-lambda0)
+	x := math.Cos(phi) * math.Sin(lambda-lambda0)
+	y := math.Cos(phi0)*math.Sin(phi) - math.Sin(phi0)*math.Cos(phi)*math.Cos(lambda-lambda0)
+
+	return x, y, cosC >= 0
+}
+
+// resizeImage scales src to width by height, averaging the source pixels covered by each destination pixel
+func resizeImage(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	bounds := src.Bounds()
+	scaleX := float64(bounds.Dx()) / float64(width)
+	scaleY := float64(bounds.Dy()) / float64(height)
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + int(float64(y)*scaleY)
+		y1 := bounds.Min.Y + int(math.Ceil(float64(y+1)*scaleY))
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + int(float64(x)*scaleX)
+			x1 := bounds.Min.X + int(math.Ceil(float64(x+1)*scaleX))
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1 && sy < bounds.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < bounds.Max.X; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+// scaledHeight returns the height of img when scaled to width, keeping its aspect ratio
+func scaledHeight(img image.Image, width int) int {
+	height := int(math.Round(float64(width) * float64(img.Bounds().Dy()) / float64(img.Bounds().Dx())))
+	if height < 1 {
+		return 1
+	}
+	return height
+}
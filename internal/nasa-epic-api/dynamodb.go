@@ -2,33 +2,60 @@ package nasa_epic_api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-func CreateDBRecordType(identifier, formattedDateString, imageLocation string, size int64, date time.Time) DBRecord {
-	return DBRecord{
-		Identifier:       identifier,
-		FormattedDateStr: formattedDateString,
-		Date:             date,
-		ImageSize:        size,
-		S3Location:       imageLocation,
+const (
+	dateIndexName       = "DateIndex"
+	datePartitionFormat = "2006-01"
+
+	// maximum number of keys/items accepted by a single BatchGetItem/BatchWriteItem request
+	batchGetItemLimit   = 100
+	batchWriteItemLimit = 25
+	// number of times unprocessed keys/items are retried before giving up
+	batchMaxRetries = 8
+)
+
+// CreateDBRecordType returns the DBRecord, at the current schema version, for a processed recording
+func CreateDBRecordType(recording *NasaEpicRecording) DBRecord {
+	record := DBRecord{
+		Identifier:       recording.Identifier,
+		FormattedDateStr: recording.FormattedDateStr,
+		Date:             recording.Date,
+		ImageSize:        recording.ImageSize,
+		ImageMD5:         recording.ImageMD5,
+		S3Location:       recording.S3Location,
+		S3Key:            recording.S3Key,
+		LocalSolarTime:   recording.LocalSolarTime,
+		Region:           recording.Region,
+		Change:           recording.Change,
 	}
+	applyRecordingMetadata(&record, recording)
+
+	return record
 }
 
-func CreateDBClient(region string) (*dynamodb.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+// CreateDBClient returns a *dynamodb.Client connected as configured by clientConfig
+func CreateDBClient(clientConfig AWSClientConfig) (*dynamodb.Client, error) {
+	cfg, err := loadAWSConfig(clientConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	client := dynamodb.NewFromConfig(cfg)
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if clientConfig.EndpointURL != "" {
+			o.EndpointResolver = dynamodb.EndpointResolverFromURL(clientConfig.EndpointURL)
+		}
+	})
 
 	return client, nil
 }
@@ -54,18 +81,10 @@ func WriteDBItem(client *dynamodb.Client, item DBRecord, tableName string) error
 	return nil
 }
 
-func CheckIfDBItemExists(client *dynamodb.Client, identifier, date string, tableName string) (bool, error) {
+func CheckIfDBItemExists(client *dynamodb.Client, key RecordKey, tableName string) (bool, error) {
 	getItemInput := &dynamodb.GetItemInput{
 		TableName: &tableName,
-
-		Key: map[string]types.AttributeValue{
-			"Identifier": &types.AttributeValueMemberS{
-				Value: identifier,
-			},
-			"FormattedDateStr": &types.AttributeValueMemberS{
-				Value: date,
-			},
-		},
+		Key:       dbItemKey(key),
 	}
 
 	result, err := client.GetItem(context.TODO(), getItemInput)
@@ -75,45 +94,579 @@ func CheckIfDBItemExists(client *dynamodb.Client, identifier, date string, table
 
 	// check whether the item has been found
 	if len(result.Item) > 0 {
-		return true, nil
+		var record DBRecord
+		err = attributevalue.UnmarshalMap(result.Item, &record)
+		if err != nil {
+			return false, fmt.Errorf("unable to unmarshal map: %v", result.Item)
+		}
+		return record.IsCompleted(), nil
 	} else {
 		return false, nil
 	}
 }
 
-// RetrieveAllItemsAsStruct reads all items from the database and returns a []NasaEpicRecording
-func RetrieveAllItemsAsStruct(client *dynamodb.Client, tableName string) ([]*NasaEpicRecording, error) {
-	var results []*NasaEpicRecording
-
-	scanInput := &dynamodb.ScanInput{
+// DeleteDBItem deletes the item matching the key
+func DeleteDBItem(client *dynamodb.Client, key RecordKey, tableName string) error {
+	deleteItemInput := &dynamodb.DeleteItemInput{
 		TableName: aws.String(tableName),
+		Key:       dbItemKey(key),
 	}
 
-	scanOutput, err := client.Scan(context.TODO(), scanInput)
+	_, err := client.DeleteItem(context.TODO(), deleteItemInput)
 	if err != nil {
-		return nil, fmt.Errorf("unable to scan table: %s", tableName)
+		return fmt.Errorf("error for DeleteItem against %s: %v", tableName, err)
 	}
 
-	if scanOutput.Count > 0 {
-		var item *NasaEpicRecording
+	return nil
+}
+
+// ClaimDBItem writes an in-progress claim for the key with a conditional PutItem. The claim only succeeds if no
+// item exists yet, or the existing item is an in-progress claim whose lease has expired
+func ClaimDBItem(client *dynamodb.Client, key RecordKey, owner string, leaseExpiry time.Time, tableName string) (bool, error) {
+	i, err := attributevalue.MarshalMap(newClaimRecord(key, owner, leaseExpiry))
+	if err != nil {
+		return false, fmt.Errorf("unable to marshal map when claiming DB item: %v", err)
+	}
+
+	putItemInput := &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                i,
+		ConditionExpression: aws.String("attribute_not_exists(RecordID) OR (#status = :inProgress AND LeaseExpiry < :now)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":inProgress": &types.AttributeValueMemberS{Value: RecordStatusInProgress},
+			":now":        &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	}
+
+	_, err = client.PutItem(context.TODO(), putItemInput)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error for conditional PutItem against %s: %v", tableName, err)
+	}
+
+	return true, nil
+}
+
+// CompleteDBItem writes the record as completed with a conditional PutItem. The write only succeeds if the item is
+// still an in-progress claim held by owner, so that a claim taken over by another run is never overwritten
+func CompleteDBItem(client *dynamodb.Client, record DBRecord, owner string, tableName string) (bool, error) {
+	i, err := attributevalue.MarshalMap(completedRecord(record, owner))
+	if err != nil {
+		return false, fmt.Errorf("unable to marshal map when completing DB item: %v", err)
+	}
 
-		for _, value := range scanOutput.Items {
-			err = attributevalue.UnmarshalMap(value, &item)
+	putItemInput := &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                i,
+		ConditionExpression: aws.String("ClaimOwner = :owner AND #status = :inProgress"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner":      &types.AttributeValueMemberS{Value: owner},
+			":inProgress": &types.AttributeValueMemberS{Value: RecordStatusInProgress},
+		},
+	}
+
+	_, err = client.PutItem(context.TODO(), putItemInput)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error for conditional PutItem against %s: %v", tableName, err)
+	}
+
+	fmt.Printf("Successfully wrote item %s to DB\n", record.Identifier)
+
+	return true, nil
+}
+
+// CheckIfDBItemsExist looks up keys with BatchGetItem in chunks of 100 and reports which were found.
+// Unprocessed keys are retried with an exponential backoff
+func CheckIfDBItemsExist(client *dynamodb.Client, keys []RecordKey, tableName string) (map[RecordKey]bool, error) {
+	found := map[RecordKey]bool{}
+
+	for start := 0; start < len(keys); start += batchGetItemLimit {
+		end := start + batchGetItemLimit
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var requestKeys []map[string]types.AttributeValue
+		for _, key := range keys[start:end] {
+			found[key] = false
+			requestKeys = append(requestKeys, dbItemKey(key))
+		}
+
+		requestItems := map[string]types.KeysAndAttributes{
+			tableName: {
+				Keys:                 requestKeys,
+				ProjectionExpression: aws.String("RecordID, #ts, #status, LeaseExpiry"),
+				ExpressionAttributeNames: map[string]string{
+					"#ts":     "Timestamp",
+					"#status": "Status",
+				},
+			},
+		}
+
+		for attempt := 0; len(requestItems) > 0; attempt++ {
+			if attempt > batchMaxRetries {
+				return nil, fmt.Errorf("unable to process all keys in BatchGetItem against %s after %d retries", tableName, batchMaxRetries)
+			}
+			batchBackoff(attempt)
+
+			output, err := client.BatchGetItem(context.TODO(), &dynamodb.BatchGetItemInput{RequestItems: requestItems})
 			if err != nil {
-				return nil, fmt.Errorf("unable to unmarshal map: %v", value)
+				return nil, fmt.Errorf("error for BatchGetItem against %s: %v", tableName, err)
+			}
+
+			for _, item := range output.Responses[tableName] {
+				var record DBRecord
+				err = attributevalue.UnmarshalMap(item, &record)
+				if err != nil {
+					return nil, fmt.Errorf("unable to unmarshal map: %v", item)
+				}
+				found[record.Key()] = record.IsCompleted()
 			}
 
-			results = append(results, item)
-			item = nil
+			requestItems = output.UnprocessedKeys
 		}
-	} else {
+	}
+
+	return found, nil
+}
+
+// WriteDBItems writes items with BatchWriteItem in chunks of 25. Unprocessed items are retried with an exponential backoff.
+// BatchWriteItem does not support conditions, so newly processed recordings are instead completed one PutItem at a time
+// by CompleteDBItem, trading a request per recording for never overwriting a claim taken over by another run
+func WriteDBItems(client *dynamodb.Client, items []DBRecord, tableName string) error {
+	for start := 0; start < len(items); start += batchWriteItemLimit {
+		end := start + batchWriteItemLimit
+		if end > len(items) {
+			end = len(items)
+		}
+
+		var writeRequests []types.WriteRequest
+		for _, item := range items[start:end] {
+			i, err := attributevalue.MarshalMap(item)
+			if err != nil {
+				return fmt.Errorf("unable to marshal map when writing DB item: %v", err)
+			}
+			writeRequests = append(writeRequests, types.WriteRequest{PutRequest: &types.PutRequest{Item: i}})
+		}
+
+		requestItems := map[string][]types.WriteRequest{tableName: writeRequests}
+
+		for attempt := 0; len(requestItems) > 0; attempt++ {
+			if attempt > batchMaxRetries {
+				return fmt.Errorf("unable to process all items in BatchWriteItem against %s after %d retries", tableName, batchMaxRetries)
+			}
+			batchBackoff(attempt)
+
+			output, err := client.BatchWriteItem(context.TODO(), &dynamodb.BatchWriteItemInput{RequestItems: requestItems})
+			if err != nil {
+				return fmt.Errorf("error for BatchWriteItem against %s: %v", tableName, err)
+			}
+
+			requestItems = output.UnprocessedItems
+		}
+
+		for _, item := range items[start:end] {
+			fmt.Printf("Successfully wrote item %s to DB\n", item.Identifier)
+		}
+	}
+
+	return nil
+}
+
+// batchBackoff sleeps before a retry of unprocessed batch keys/items. The first attempt does not sleep
+func batchBackoff(attempt int) {
+	if attempt == 0 {
+		return
+	}
+	time.Sleep(time.Duration(50<<uint(attempt)) * time.Millisecond)
+}
+
+// dbItemKey returns the primary key attributes of an item
+func dbItemKey(key RecordKey) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"RecordID": &types.AttributeValueMemberS{
+			Value: key.RecordID,
+		},
+		"Timestamp": &types.AttributeValueMemberS{
+			Value: key.Timestamp,
+		},
+	}
+}
+
+// GetDBItem returns the item matching the key as a *DBRecord, or nil if not found
+func GetDBItem(client *dynamodb.Client, key RecordKey, tableName string) (*DBRecord, error) {
+	getItemInput := &dynamodb.GetItemInput{
+		TableName: &tableName,
+		Key:       dbItemKey(key),
+	}
+
+	result, err := client.GetItem(context.TODO(), getItemInput)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Item) == 0 {
 		return nil, nil
 	}
 
-	// sort records based on date/time
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Date.Before(results[j].Date)
+	var record DBRecord
+	err = attributevalue.UnmarshalMap(result.Item, &record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal map: %v", result.Item)
+	}
+
+	return &record, nil
+}
+
+// RetrieveAllItemsAsStruct reads all items from the database and returns a []*DBRecord.
+// When segments is greater than 1 the table is read with a parallel segmented scan
+func RetrieveAllItemsAsStruct(client *dynamodb.Client, tableName string, segments int) ([]*DBRecord, error) {
+	if segments <= 1 {
+		results, err := scanTableSegment(client, tableName, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		SortRecordsByDate(results)
+		return results, nil
+	}
+
+	var wg sync.WaitGroup
+	segmentResults := make([][]*DBRecord, segments)
+	segmentErrors := make([]error, segments)
+
+	for i := 0; i < segments; i++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			segmentResults[segment], segmentErrors[segment] = scanTableSegment(client, tableName,
+				aws.Int32(int32(segment)), aws.Int32(int32(segments)))
+		}(i)
+	}
+	wg.Wait()
+
+	var results []*DBRecord
+	for i := 0; i < segments; i++ {
+		if segmentErrors[i] != nil {
+			return nil, fmt.Errorf("scan of segment %d/%d failed: %v", i, segments, segmentErrors[i])
+		}
+		results = append(results, segmentResults[i]...)
+	}
+
+	SortRecordsByDate(results)
+
+	return results, nil
+}
+
+// scanTableSegment reads every page of a single scan segment. A nil segment scans the whole table
+func scanTableSegment(client *dynamodb.Client, tableName string, segment, totalSegments *int32) ([]*DBRecord, error) {
+	var results []*DBRecord
+
+	err := scanTablePages(client, tableName, segment, totalSegments, func(items []*DBRecord) error {
+		results = append(results, items...)
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return results, nil
 }
+
+// scanTablePages calls fn with the items of each page of a single scan segment as it is read. A nil segment scans
+// the whole table
+func scanTablePages(client *dynamodb.Client, tableName string, segment, totalSegments *int32, fn func(items []*DBRecord) error) error {
+	scanInput := &dynamodb.ScanInput{
+		TableName:     aws.String(tableName),
+		Segment:       segment,
+		TotalSegments: totalSegments,
+	}
+
+	paginator := dynamodb.NewScanPaginator(client, scanInput)
+	for paginator.HasMorePages() {
+		scanOutput, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return fmt.Errorf("unable to scan table %s: %v", tableName, err)
+		}
+
+		var items []*DBRecord
+		err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, &items)
+		if err != nil {
+			return fmt.Errorf("unable to unmarshal scanned items from %s: %v", tableName, err)
+		}
+
+		err = fn(items)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueryDBItemsByDateRange reads the items dated between from and to (inclusive) via the date secondary index.
+// One query is issued per year-month partition covered by the range
+func QueryDBItemsByDateRange(client *dynamodb.Client, tableName string, from, to time.Time) ([]*DBRecord, error) {
+	var results []*DBRecord
+
+	from = from.UTC()
+	to = to.UTC()
+
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(to); month = month.AddDate(0, 1, 0) {
+		queryInput := &dynamodb.QueryInput{
+			TableName:              aws.String(tableName),
+			IndexName:              aws.String(dateIndexName),
+			KeyConditionExpression: aws.String("DatePartition = :partition AND #ts BETWEEN :from AND :to"),
+			ExpressionAttributeNames: map[string]string{
+				"#ts": "Timestamp",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":partition": &types.AttributeValueMemberS{Value: month.Format(datePartitionFormat)},
+				":from":      &types.AttributeValueMemberS{Value: from.Format(time.RFC3339)},
+				":to":        &types.AttributeValueMemberS{Value: to.Format(time.RFC3339)},
+			},
+		}
+
+		paginator := dynamodb.NewQueryPaginator(client, queryInput)
+		for paginator.HasMorePages() {
+			queryOutput, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				return nil, fmt.Errorf("unable to query %s on index %s: %v", tableName, dateIndexName, err)
+			}
+
+			var items []*DBRecord
+			err = attributevalue.UnmarshalListOfMaps(queryOutput.Items, &items)
+			if err != nil {
+				return nil, fmt.Errorf("unable to unmarshal queried items from %s: %v", tableName, err)
+			}
+
+			results = append(results, items...)
+		}
+	}
+
+	return results, nil
+}
+
+// DynamoDBRecordingStore is a RecordingStore backed by a DynamoDB table
+type DynamoDBRecordingStore struct {
+	client       *dynamodb.Client
+	tableName    string
+	scanSegments int
+}
+
+// NewDynamoDBRecordingStore returns a *DynamoDBRecordingStore. List uses a parallel scan when scanSegments is greater than 1
+func NewDynamoDBRecordingStore(client *dynamodb.Client, tableName string, scanSegments int) *DynamoDBRecordingStore {
+	return &DynamoDBRecordingStore{
+		client:       client,
+		tableName:    tableName,
+		scanSegments: scanSegments,
+	}
+}
+
+func (d *DynamoDBRecordingStore) Exists(key RecordKey) (bool, error) {
+	return CheckIfDBItemExists(d.client, key, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) ExistsBatch(keys []RecordKey) (map[RecordKey]bool, error) {
+	return CheckIfDBItemsExist(d.client, keys, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) Claim(key RecordKey, owner string, leaseExpiry time.Time) (bool, error) {
+	return ClaimDBItem(d.client, key, owner, leaseExpiry, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) Complete(record DBRecord, owner string) (bool, error) {
+	return CompleteDBItem(d.client, record, owner, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) Put(record DBRecord) error {
+	return WriteDBItem(d.client, record, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) PutBatch(records []DBRecord) error {
+	return WriteDBItems(d.client, records, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) Delete(key RecordKey) error {
+	return DeleteDBItem(d.client, key, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) Get(key RecordKey) (*DBRecord, error) {
+	return GetDBItem(d.client, key, d.tableName)
+}
+
+func (d *DynamoDBRecordingStore) List(filter RecordingFilter) ([]*DBRecord, error) {
+	records, err := RetrieveAllItemsAsStruct(d.client, d.tableName, d.scanSegments)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*DBRecord
+	for _, record := range records {
+		if filter.Matches(record) {
+			results = append(results, record)
+		}
+	}
+
+	return results, nil
+}
+
+// Each scans the table a page at a time, so records are passed to fn in no particular order
+func (d *DynamoDBRecordingStore) Each(filter RecordingFilter, fn func(record *DBRecord) error) error {
+	return scanTablePages(d.client, d.tableName, nil, nil, func(items []*DBRecord) error {
+		for _, record := range items {
+			if !filter.Matches(record) {
+				continue
+			}
+			err := fn(record)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *DynamoDBRecordingStore) QueryByDateRange(from, to time.Time) ([]*DBRecord, error) {
+	return QueryDBItemsByDateRange(d.client, d.tableName, from, to)
+}
+
+// DynamoDBRunStore is a RunStore backed by a DynamoDB table keyed on RunID. Watermarks are stored in the same
+// table under a "watermark#" prefixed RunID
+type DynamoDBRunStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewDynamoDBRunStore(client *dynamodb.Client, tableName string) *DynamoDBRunStore {
+	return &DynamoDBRunStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+func (d *DynamoDBRunStore) PutRun(run RunRecord) error {
+	i, err := attributevalue.MarshalMap(run)
+	if err != nil {
+		return fmt.Errorf("unable to marshal map when writing run: %v", err)
+	}
+
+	_, err = d.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      i,
+	})
+	if err != nil {
+		return fmt.Errorf("error for PutItem against %s: %v", d.tableName, err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBRunStore) GetRun(runID string) (*RunRecord, error) {
+	result, err := d.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"RunID": &types.AttributeValueMemberS{Value: runID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error for GetItem against %s: %v", d.tableName, err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	var run RunRecord
+	err = attributevalue.UnmarshalMap(result.Item, &run)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal map: %v", result.Item)
+	}
+
+	return &run, nil
+}
+
+func (d *DynamoDBRunStore) ListRuns(limit int) ([]*RunRecord, error) {
+	var runs []*RunRecord
+
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{TableName: aws.String(d.tableName)})
+	for paginator.HasMorePages() {
+		scanOutput, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan table %s: %v", d.tableName, err)
+		}
+
+		var items []*RunRecord
+		err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, &items)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unmarshal scanned items from %s: %v", d.tableName, err)
+		}
+
+		for _, item := range items {
+			if !strings.HasPrefix(item.RunID, "watermark#") {
+				runs = append(runs, item)
+			}
+		}
+	}
+
+	return sortRunsByStartTime(runs, limit), nil
+}
+
+// watermarkItem is the DynamoDB item holding a watermark
+type watermarkItem struct {
+	RunID     string
+	Watermark time.Time
+}
+
+func (d *DynamoDBRunStore) GetWatermark(collection, region string) (time.Time, error) {
+	result, err := d.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"RunID": &types.AttributeValueMemberS{Value: watermarkID(collection, region)},
+		},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error for GetItem against %s: %v", d.tableName, err)
+	}
+
+	if len(result.Item) == 0 {
+		return time.Time{}, nil
+	}
+
+	var item watermarkItem
+	err = attributevalue.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to unmarshal map: %v", result.Item)
+	}
+
+	return item.Watermark, nil
+}
+
+func (d *DynamoDBRunStore) PutWatermark(collection, region string, date time.Time) error {
+	i, err := attributevalue.MarshalMap(watermarkItem{RunID: watermarkID(collection, region), Watermark: date})
+	if err != nil {
+		return fmt.Errorf("unable to marshal map when writing watermark: %v", err)
+	}
+
+	_, err = d.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      i,
+	})
+	if err != nil {
+		return fmt.Errorf("error for PutItem against %s: %v", d.tableName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package nasa_epic_api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	ExportFormatJSONLines = "jsonl"
+	ExportFormatCSV       = "csv"
+
+	// number of imported records written to the store at a time
+	importBatchSize = 100
+)
+
+// csvColumns is the header row of CSV exports. Nested coordinates, positions and change results are flattened
+var csvColumns = []string{
+	"SchemaVersion", "RecordID", "Timestamp", "DatePartition", "Identifier", "FormattedDateStr", "ImageSize",
+	"ImageMD5", "S3Location", "S3Key", "Date", "LocalSolarTime", "Region", "Caption", "Image", "Version",
+	"Collection", "CentroidLat", "CentroidLon",
+	"DscovrX", "DscovrY", "DscovrZ", "LunarX", "LunarY", "LunarZ", "SunX", "SunY", "SunZ",
+	"ChangePreviousRecordID", "ChangeScore", "ChangeFlagged", "ChangeDiffKey",
+}
+
+// ExportRecords streams every record matching filter to w in the given format, writing each record as it is read
+// from the store. It returns the number of records written
+func ExportRecords(store RecordingStore, filter RecordingFilter, format string, w io.Writer) (int, error) {
+	var write func(record *DBRecord) error
+	var flush func() error
+
+	switch format {
+	case ExportFormatJSONLines:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		write = func(record *DBRecord) error {
+			return encoder.Encode(record)
+		}
+		flush = buffered.Flush
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		err := writer.Write(csvColumns)
+		if err != nil {
+			return 0, fmt.Errorf("unable to write export: %v", err)
+		}
+		write = func(record *DBRecord) error {
+			return writer.Write(recordToCSV(record))
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		return 0, fmt.Errorf("unknown export format: %s", format)
+	}
+
+	exported := 0
+	err := store.Each(filter, func(record *DBRecord) error {
+		err := write(record)
+		if err != nil {
+			return fmt.Errorf("unable to write item %s: %v", record.Identifier, err)
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		return exported, fmt.Errorf("unable to export records: %v", err)
+	}
+
+	err = flush()
+	if err != nil {
+		return exported, fmt.Errorf("unable to write export: %v", err)
+	}
+
+	return exported, nil
+}
+
+// ImportRecords reads records in the given format from r and upserts them into the store in batches, replacing
+// any existing records with the same keys. Of several records sharing a key, such as in a concatenated export, the
+// last is kept. Records exported before the RecordID/Timestamp key scheme have their key derived on import. It
+// returns the number of records imported
+func ImportRecords(store RecordingStore, format string, r io.Reader) (int, error) {
+	var next func() (*DBRecord, error)
+
+	switch format {
+	case ExportFormatJSONLines:
+		decoder := json.NewDecoder(bufio.NewReader(r))
+		next = func() (*DBRecord, error) {
+			var record DBRecord
+			err := decoder.Decode(&record)
+			if err != nil {
+				return nil, err
+			}
+			return &record, nil
+		}
+	case ExportFormatCSV:
+		reader := csv.NewReader(bufio.NewReader(r))
+		header, err := reader.Read()
+		if err != nil {
+			return 0, fmt.Errorf("unable to read CSV header: %v", err)
+		}
+		next = func() (*DBRecord, error) {
+			row, err := reader.Read()
+			if err != nil {
+				return nil, err
+			}
+			return recordFromCSV(header, row)
+		}
+	default:
+		return 0, fmt.Errorf("unknown import format: %s", format)
+	}
+
+	imported := 0
+	read := 0
+	var batch []DBRecord
+	flush := func() error {
+		// a batch writing the same key twice is rejected by DynamoDB, so only the last record of each key is kept
+		deduped := dedupeRecords(batch)
+		err := store.PutBatch(deduped)
+		if err != nil {
+			return fmt.Errorf("unable to write imported records: %v", err)
+		}
+		imported += len(deduped)
+		batch = nil
+		return nil
+	}
+
+	for {
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("unable to read record %d: %v", read+1, err)
+		}
+		read++
+
+		if record.RecordID == "" || record.Timestamp == "" {
+			applyRecordKey(record)
+		}
+		batch = append(batch, *record)
+
+		if len(batch) == importBatchSize {
+			err = flush()
+			if err != nil {
+				return imported, err
+			}
+		}
+	}
+
+	if len(batch) > 0 {
+		err := flush()
+		if err != nil {
+			return imported, err
+		}
+	}
+
+	return imported, nil
+}
+
+// dedupeRecords returns records keeping only the last of those sharing a key, in the position of the first
+func dedupeRecords(records []DBRecord) []DBRecord {
+	positions := map[RecordKey]int{}
+	var deduped []DBRecord
+	for _, record := range records {
+		if i, found := positions[record.Key()]; found {
+			deduped[i] = record
+			continue
+		}
+		positions[record.Key()] = len(deduped)
+		deduped = append(deduped, record)
+	}
+	return deduped
+}
+
+// recordToCSV returns the record as a row matching csvColumns
+func recordToCSV(r *DBRecord) []string {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	change := []string{"", "", "", ""}
+	if r.Change != nil {
+		change = []string{r.Change.PreviousRecordID, f(r.Change.Score), strconv.FormatBool(r.Change.Flagged), r.Change.DiffKey}
+	}
+
+	return append([]string{
+		strconv.Itoa(r.SchemaVersion), r.RecordID, r.Timestamp, r.DatePartition, r.Identifier, r.FormattedDateStr,
+		strconv.FormatInt(r.ImageSize, 10), r.ImageMD5, r.S3Location, r.S3Key, r.Date.Format(time.RFC3339Nano),
+		r.LocalSolarTime, r.Region, r.Caption, r.Image, r.Version, r.Collection,
+		f(r.CentroidCoordinates.Lat), f(r.CentroidCoordinates.Lon),
+		f(r.DscovrPosition.X), f(r.DscovrPosition.Y), f(r.DscovrPosition.Z),
+		f(r.LunarPosition.X), f(r.LunarPosition.Y), f(r.LunarPosition.Z),
+		f(r.SunPosition.X), f(r.SunPosition.Y), f(r.SunPosition.Z),
+	}, change...)
+}
+
+// recordFromCSV parses a row whose columns are named by header. Unknown columns are ignored and missing
+// columns left at their zero value
+func recordFromCSV(header, row []string) (*DBRecord, error) {
+	if len(row) != len(header) {
+		return nil, fmt.Errorf("expected %d columns but found %d", len(header), len(row))
+	}
+
+	var r DBRecord
+	var err error
+
+	// the change result is only set when one of its columns has a value
+	change := func() *ChangeResult {
+		if r.Change == nil {
+			r.Change = &ChangeResult{}
+		}
+		return r.Change
+	}
+
+	for i, column := range header {
+		value := row[i]
+		if value == "" {
+			continue
+		}
+
+		switch column {
+		case "SchemaVersion":
+			r.SchemaVersion, err = strconv.Atoi(value)
+		case "RecordID":
+			r.RecordID = value
+		case "Timestamp":
+			r.Timestamp = value
+		case "DatePartition":
+			r.DatePartition = value
+		case "Identifier":
+			r.Identifier = value
+		case "FormattedDateStr":
+			r.FormattedDateStr = value
+		case "ImageSize":
+			r.ImageSize, err = strconv.ParseInt(value, 10, 64)
+		case "ImageMD5":
+			r.ImageMD5 = value
+		case "S3Location":
+			r.S3Location = value
+		case "S3Key":
+			r.S3Key = value
+		case "Date":
+			r.Date, err = time.Parse(time.RFC3339Nano, value)
+		case "LocalSolarTime":
+			r.LocalSolarTime = value
+		case "Region":
+			r.Region = value
+		case "Caption":
+			r.Caption = value
+		case "Image":
+			r.Image = value
+		case "Version":
+			r.Version = value
+		case "Collection":
+			r.Collection = value
+		case "CentroidLat":
+			r.CentroidCoordinates.Lat, err = strconv.ParseFloat(value, 64)
+		case "CentroidLon":
+			r.CentroidCoordinates.Lon, err = strconv.ParseFloat(value, 64)
+		case "DscovrX":
+			r.DscovrPosition.X, err = strconv.ParseFloat(value, 64)
+		case "DscovrY":
+			r.DscovrPosition.Y, err = strconv.ParseFloat(value, 64)
+		case "DscovrZ":
+			r.DscovrPosition.Z, err = strconv.ParseFloat(value, 64)
+		case "LunarX":
+			r.LunarPosition.X, err = strconv.ParseFloat(value, 64)
+		case "LunarY":
+			r.LunarPosition.Y, err = strconv.ParseFloat(value, 64)
+		case "LunarZ":
+			r.LunarPosition.Z, err = strconv.ParseFloat(value, 64)
+		case "SunX":
+			r.SunPosition.X, err = strconv.ParseFloat(value, 64)
+		case "SunY":
+			r.SunPosition.Y, err = strconv.ParseFloat(value, 64)
+		case "SunZ":
+			r.SunPosition.Z, err = strconv.ParseFloat(value, 64)
+		case "ChangePreviousRecordID":
+			change().PreviousRecordID = value
+		case "ChangeScore":
+			change().Score, err = strconv.ParseFloat(value, 64)
+		case "ChangeFlagged":
+			change().Flagged, err = strconv.ParseBool(value)
+		case "ChangeDiffKey":
+			change().DiffKey = value
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse column %s value %s: %v", column, value, err)
+		}
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,96 @@
+package nasa_epic_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	changed := testRecord("a", date)
+	changed.SchemaVersion = CurrentSchemaVersion
+	changed.Region = "default"
+	changed.Change = &ChangeResult{
+		PreviousRecordID: "natural#b",
+		Score:            0.215,
+		Flagged:          true,
+		DiffKey:          changed.DiffKey(),
+	}
+	unchanged := testRecord("c", date.Add(time.Hour))
+	unchanged.SchemaVersion = CurrentSchemaVersion
+
+	for _, format := range []string{ExportFormatJSONLines, ExportFormatCSV} {
+		source := NewMemoryRecordingStore()
+		source.Put(changed)
+		source.Put(unchanged)
+
+		var export bytes.Buffer
+		exported, err := ExportRecords(source, RecordingFilter{}, format, &export)
+		if err != nil || exported != 2 {
+			t.Fatalf("%s: expected 2 records exported, got %d, %v", format, exported, err)
+		}
+
+		destination := NewMemoryRecordingStore()
+		imported, err := ImportRecords(destination, format, &export)
+		if err != nil || imported != 2 {
+			t.Fatalf("%s: expected 2 records imported, got %d, %v", format, imported, err)
+		}
+
+		for _, want := range []DBRecord{changed, unchanged} {
+			got, _ := destination.Get(want.Key())
+			if got == nil {
+				t.Fatalf("%s: record %s was not imported", format, want.Identifier)
+			}
+			if !reflect.DeepEqual(got.Change, want.Change) {
+				t.Errorf("%s: record %s change %+v, want %+v", format, want.Identifier, got.Change, want.Change)
+			}
+		}
+	}
+}
+
+// batchKeyCheckingStore rejects batches writing the same key twice, as DynamoDB BatchWriteItem does
+type batchKeyCheckingStore struct {
+	*MemoryRecordingStore
+}
+
+func (s batchKeyCheckingStore) PutBatch(records []DBRecord) error {
+	seen := map[RecordKey]bool{}
+	for _, record := range records {
+		if seen[record.Key()] {
+			return fmt.Errorf("provided list of item keys contains duplicates: %s", record.Identifier)
+		}
+		seen[record.Key()] = true
+	}
+	return s.MemoryRecordingStore.PutBatch(records)
+}
+
+func TestImportDedupesKeysWithinBatch(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	first := testRecord("a", date)
+	first.Caption = "first"
+	last := first
+	last.Caption = "last"
+
+	// a concatenated export holding the same record twice
+	var export bytes.Buffer
+	for _, record := range []DBRecord{first, testRecord("b", date.Add(time.Hour)), last} {
+		line, _ := json.Marshal(record)
+		export.Write(line)
+		export.WriteByte('\n')
+	}
+
+	store := batchKeyCheckingStore{NewMemoryRecordingStore()}
+	imported, err := ImportRecords(store, ExportFormatJSONLines, &export)
+	if err != nil || imported != 2 {
+		t.Fatalf("expected 2 records imported, got %d, %v", imported, err)
+	}
+
+	got, _ := store.Get(first.Key())
+	if got == nil || got.Caption != "last" {
+		t.Errorf("expected the last record of a duplicated key to be imported, got %+v", got)
+	}
+}
@@ -0,0 +1,330 @@
+package nasa_epic_api
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// feedPrefix is the key prefix of every generated feed
+	feedPrefix = "feeds/"
+	// feedRoot is the path from a feed back to the root of the site
+	feedRoot = "../"
+
+	// DefaultFeedSize is the number of the most recent recordings in each feed when not configured
+	DefaultFeedSize = 20
+
+	feedTitle    = "Matched Coordinate Nasa Records"
+	feedAuthor   = "nasa-epic-project"
+	feedIDPrefix = "urn:nasa-epic-project:"
+	mediaRSSNS   = "http://search.yahoo.com/mrss/"
+)
+
+// feedLink is a published feed, as linked from the landing page
+type feedLink struct {
+	Title string
+	Key   string
+	Type  string
+}
+
+type atomFeed struct {
+	XMLName    xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	XMLNSMedia string      `xml:"xmlns:media,attr"`
+	ID         string      `xml:"id"`
+	Title      string      `xml:"title"`
+	Updated    string      `xml:"updated"`
+	Author     atomPerson  `xml:"author"`
+	Links      []atomLink  `xml:"link"`
+	Entries    []atomEntry `xml:"entry"`
+}
+
+// atomPerson is the author of a feed, which its entries inherit
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string          `xml:"id"`
+	Title     string          `xml:"title"`
+	Updated   string          `xml:"updated"`
+	Published string          `xml:"published"`
+	Link      atomLink        `xml:"link"`
+	Summary   string          `xml:"summary,omitempty"`
+	Content   atomContent     `xml:"content"`
+	Thumbnail *mediaThumbnail `xml:"media:thumbnail"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type mediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+type rssFeed struct {
+	XMLName    xml.Name   `xml:"rss"`
+	Version    string     `xml:"version,attr"`
+	XMLNSMedia string     `xml:"xmlns:media,attr"`
+	Channel    rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string          `xml:"title"`
+	Link        string          `xml:"link"`
+	GUID        rssGUID         `xml:"guid"`
+	PubDate     string          `xml:"pubDate"`
+	Description string          `xml:"description"`
+	Thumbnail   *mediaThumbnail `xml:"media:thumbnail"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+// feedEntryContent renders the HTML body of a feed entry
+var feedEntryContent = template.Must(template.New("feedEntry").Parse(
+	`<p><a href="{{.Link}}"><img src="{{.Thumbnail}}" alt="{{.Identifier}}"></a></p>{{if .Caption}}<p>{{.Caption}}</p>{{end}}`))
+
+// generateFeeds renders the Atom feeds, and the RSS 2.0 feeds if rss is set, of the latest size records, one
+// across every region and one per region. It returns the rendered feeds keyed on their object key, and the links
+// to them. Feeds are only dated by their records so that they are unchanged until a new record is added
+func generateFeeds(records []*DBRecord, objects ObjectStore, size int, rss bool) (map[string][]byte, []feedLink, error) {
+	if size <= 0 {
+		size = DefaultFeedSize
+	}
+
+	feeds := map[string][]byte{}
+	var links []feedLink
+
+	groups := groupRecordsByRegion(records)
+	regions := make([]string, 0, len(groups))
+	for region := range groups {
+		if region != "" {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+
+	type feedSource struct {
+		name    string
+		title   string
+		records []*DBRecord
+	}
+	sources := []feedSource{{name: "all", title: feedTitle, records: records}}
+	slugs := regionSlugs(regions)
+	for _, region := range regions {
+		sources = append(sources, feedSource{
+			name:    "region-" + slugs[region],
+			title:   fmt.Sprintf("%s - %s", feedTitle, region),
+			records: groups[region],
+		})
+	}
+
+	for _, source := range sources {
+		latest := make([]*DBRecord, len(source.records))
+		copy(latest, source.records)
+		sort.SliceStable(latest, func(i, j int) bool {
+			return latest[i].Date.After(latest[j].Date)
+		})
+		if len(latest) > size {
+			latest = latest[:size]
+		}
+
+		atomKey := feedPrefix + source.name + ".atom.xml"
+		body, err := renderAtomFeed(latest, objects, source.name, source.title, atomKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to render feed %s: %v", atomKey, err)
+		}
+		feeds[atomKey] = body
+		links = append(links, feedLink{Title: source.title + " (Atom)", Key: atomKey, Type: "application/atom+xml"})
+
+		if rss {
+			rssKey := feedPrefix + source.name + ".rss.xml"
+			body, err = renderRSSFeed(latest, objects, source.title)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to render feed %s: %v", rssKey, err)
+			}
+			feeds[rssKey] = body
+			links = append(links, feedLink{Title: source.title + " (RSS)", Key: rssKey, Type: "application/rss+xml"})
+		}
+	}
+
+	return feeds, links, nil
+}
+
+func renderAtomFeed(records []*DBRecord, objects ObjectStore, name, title, key string) ([]byte, error) {
+	feed := atomFeed{
+		XMLNSMedia: mediaRSSNS,
+		ID:         feedIDPrefix + "feed:" + name,
+		Title:      title,
+		Updated:    time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Author:     atomPerson{Name: feedAuthor},
+		Links: []atomLink{
+			{Href: feedURL(objects, key), Rel: "self", Type: "application/atom+xml"},
+			{Href: feedURL(objects, "index.html"), Rel: "alternate", Type: "text/html"},
+		},
+	}
+	if len(records) > 0 {
+		feed.Updated = records[0].Date.UTC().Format(time.RFC3339)
+	}
+
+	for _, record := range records {
+		content, thumbnail, err := feedEntry(record, objects)
+		if err != nil {
+			return nil, err
+		}
+		published := record.Date.UTC().Format(time.RFC3339)
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        feedEntryID(record),
+			Title:     feedEntryTitle(record),
+			Updated:   published,
+			Published: published,
+			Link:      atomLink{Href: feedURL(objects, record.PageKey()), Rel: "alternate", Type: "text/html"},
+			Summary:   record.Caption,
+			Content:   atomContent{Type: "html", Body: content},
+			Thumbnail: &mediaThumbnail{URL: thumbnail},
+		})
+	}
+
+	return marshalFeed(feed)
+}
+
+func renderRSSFeed(records []*DBRecord, objects ObjectStore, title string) ([]byte, error) {
+	feed := rssFeed{
+		Version:    "2.0",
+		XMLNSMedia: mediaRSSNS,
+		Channel: rssChannel{
+			Title:       title,
+			Link:        feedURL(objects, "index.html"),
+			Description: "Nasa EPIC recordings in the matched coordinate range",
+		},
+	}
+	if len(records) > 0 {
+		feed.Channel.LastBuildDate = records[0].Date.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, record := range records {
+		content, thumbnail, err := feedEntry(record, objects)
+		if err != nil {
+			return nil, err
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       feedEntryTitle(record),
+			Link:        feedURL(objects, record.PageKey()),
+			GUID:        rssGUID{ID: feedEntryID(record)},
+			PubDate:     record.Date.UTC().Format(time.RFC1123Z),
+			Description: content,
+			Thumbnail:   &mediaThumbnail{URL: thumbnail},
+		})
+	}
+
+	return marshalFeed(feed)
+}
+
+// feedEntryID returns the ID of a record's feed entries, which never changes for the same recording
+func feedEntryID(record *DBRecord) string {
+	collection, identifier := splitRecordID(record.Key().RecordID)
+	return feedIDPrefix + "recording:" + collection + ":" + identifier
+}
+
+func feedEntryTitle(record *DBRecord) string {
+	if record.Region == "" {
+		return fmt.Sprintf("%s recorded %s UTC", record.Identifier, record.Date.UTC().Format("2006-01-02 15:04"))
+	}
+	return fmt.Sprintf("%s recorded %s UTC over %s", record.Identifier, record.Date.UTC().Format("2006-01-02 15:04"), record.Region)
+}
+
+// feedEntry returns the HTML content and thumbnail URL of a record's feed entries. Thumbnails are served by the
+// EPIC archive, falling back to the full image for records without an image name
+func feedEntry(record *DBRecord, objects ObjectStore) (string, string, error) {
+	thumbnail := record.ThumbnailURL()
+	if thumbnail == "" {
+		thumbnail = relativeLink(feedRoot, recordImageURL(record, objects))
+	}
+
+	var content bytes.Buffer
+	err := feedEntryContent.Execute(&content, struct {
+		Link       string
+		Thumbnail  string
+		Identifier string
+		Caption    string
+	}{feedURL(objects, record.PageKey()), thumbnail, record.Identifier, record.Caption})
+	if err != nil {
+		return "", "", err
+	}
+
+	return content.String(), thumbnail, nil
+}
+
+// feedURL returns the URL of key as linked from a feed. Keys returned by a file object store without a base URL
+// are linked relative to the feed, as they are from the gallery pages
+func feedURL(objects ObjectStore, key string) string {
+	return relativeLink(feedRoot, objects.PublicURL(key))
+}
+
+func marshalFeed(feed interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// regionSlugs returns the slug of each of the sorted regions. Where names differ only in case or punctuation and so
+// share a slug, the first keeps it and the others are suffixed with a hash of their name, so that their feeds do not
+// overwrite each other
+func regionSlugs(regions []string) map[string]string {
+	slugs := map[string]string{}
+	taken := map[string]bool{}
+	for _, region := range regions {
+		slug := slugify(region)
+		if taken[slug] {
+			hash := sha1.Sum([]byte(region))
+			slug += "-" + hex.EncodeToString(hash[:4])
+		}
+		taken[slug] = true
+		slugs[region] = slug
+	}
+	return slugs
+}
+
+// slugify returns name lowercased with every run of characters other than letters and digits replaced by a hyphen,
+// for use in object keys
+func slugify(name string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			slug.WriteRune(c)
+			hyphen = false
+		} else if !hyphen && slug.Len() > 0 {
+			slug.WriteRune('-')
+			hyphen = true
+		}
+	}
+	return strings.TrimSuffix(slug.String(), "-")
+}
@@ -0,0 +1,49 @@
+package nasa_epic_api
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestGenerateFeedsHaveAnAuthor(t *testing.T) {
+	record := testRecord("20230101003633", time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC))
+	record.Region = "southern-africa"
+
+	feeds, _, err := generateFeeds([]*DBRecord{&record}, NewFileObjectStore(t.TempDir(), ""), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, body := range feeds {
+		var feed atomFeed
+		err = xml.Unmarshal(body, &feed)
+		if err != nil {
+			t.Fatalf("unable to parse %s: %v", key, err)
+		}
+		if feed.Author.Name == "" {
+			t.Errorf("feed %s has no author", key)
+		}
+	}
+}
+
+func TestGenerateFeedsDisambiguateRegionSlugs(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	first := testRecord("20230101003633", date)
+	first.Region = "Southern Africa"
+	second := testRecord("20230101020000", date.Add(time.Hour))
+	second.Region = "southern-africa"
+
+	feeds, links, err := generateFeeds([]*DBRecord{&first, &second}, NewFileObjectStore(t.TempDir(), ""), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the combined feed and one per region
+	if len(feeds) != 3 || len(links) != 3 {
+		t.Fatalf("expected 3 distinct feeds, got %d feeds and %d links", len(feeds), len(links))
+	}
+	if _, found := feeds[feedPrefix+"region-southern-africa.atom.xml"]; !found {
+		t.Errorf("expected the first region to keep its plain slug")
+	}
+}
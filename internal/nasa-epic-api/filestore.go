@@ -0,0 +1,451 @@
+package nasa_epic_api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	fileStoreOpPut    = "put"
+	fileStoreOpDelete = "delete"
+)
+
+// fileStoreEntry is a single line of the FileRecordingStore log
+type fileStoreEntry struct {
+	Op     string
+	Record DBRecord
+}
+
+// FileRecordingStore is a RecordingStore persisted to an append-only JSON Lines log on local disk.
+// Every write is a single appended line which is synced before returning. On open the log is replayed into
+// memory and any torn trailing line left by a crash is truncated away, while corruption before the final line is
+// reported as an error. A write which fails part way is truncated away before returning. When the log is opened
+// with more superseded entries than live ones it is compacted into a fresh file via an atomic rename.
+// Only a single process should open the log at a time
+type FileRecordingStore struct {
+	mu   sync.RWMutex
+	path string
+	file *os.File
+
+	records      map[string]DBRecord
+	byIdentifier map[string][]string
+	byDate       []string
+	superseded   int
+
+	// torn is set when a failed write could not be rolled back, after which nothing more is appended
+	torn error
+}
+
+// OpenFileRecordingStore opens, or creates, the log at path and replays it into memory
+func OpenFileRecordingStore(path string) (*FileRecordingStore, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create directory for recording store %s: %v", path, err)
+	}
+
+	file, err2 := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err2 != nil {
+		return nil, fmt.Errorf("unable to open recording store %s: %v", path, err2)
+	}
+
+	f := &FileRecordingStore{
+		path:         path,
+		file:         file,
+		records:      map[string]DBRecord{},
+		byIdentifier: map[string][]string{},
+	}
+
+	err = f.recover()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if f.superseded > len(f.records) {
+		err = f.compact()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// recover replays the log into memory, truncating any incomplete or corrupt final entry
+func (f *FileRecordingStore) recover() error {
+	reader := bufio.NewReader(f.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				fmt.Printf("discarding incomplete entry at offset %d of %s\n", offset, f.path)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read recording store %s: %v", f.path, err)
+		}
+
+		var entry fileStoreEntry
+		err = json.Unmarshal(bytes.TrimSpace(line), &entry)
+		if err != nil {
+			// only the final line can be the result of a torn write. Corruption before it would lose every valid
+			// entry after it if truncated, so it is left for an operator to repair
+			if _, err2 := reader.Peek(1); err2 != io.EOF {
+				return fmt.Errorf("corrupt entry at offset %d of recording store %s: %v", offset, f.path, err)
+			}
+			fmt.Printf("discarding corrupt trailing entry at offset %d of %s: %v\n", offset, f.path, err)
+			break
+		}
+
+		f.apply(entry)
+		offset += int64(len(line))
+	}
+
+	err := f.file.Truncate(offset)
+	if err != nil {
+		return fmt.Errorf("unable to truncate recording store %s: %v", f.path, err)
+	}
+
+	_, err = f.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("unable to seek recording store %s: %v", f.path, err)
+	}
+
+	return nil
+}
+
+// apply updates the in-memory indexes with a log entry
+func (f *FileRecordingStore) apply(entry fileStoreEntry) {
+	key := recordKey(entry.Record.Key())
+
+	if _, found := f.records[key]; found {
+		f.superseded++
+		f.removeFromIndexes(key)
+	}
+
+	switch entry.Op {
+	case fileStoreOpPut:
+		f.records[key] = entry.Record
+		f.byIdentifier[entry.Record.Identifier] = append(f.byIdentifier[entry.Record.Identifier], key)
+		f.insertIntoDateIndex(key)
+	case fileStoreOpDelete:
+		// the tombstone itself is dropped on the next compaction
+		f.superseded++
+	}
+}
+
+// insertIntoDateIndex adds key to the date sorted index
+func (f *FileRecordingStore) insertIntoDateIndex(key string) {
+	date := f.records[key].Date
+	i := sort.Search(len(f.byDate), func(i int) bool {
+		return f.records[f.byDate[i]].Date.After(date)
+	})
+	f.byDate = append(f.byDate, "")
+	copy(f.byDate[i+1:], f.byDate[i:])
+	f.byDate[i] = key
+}
+
+func (f *FileRecordingStore) removeFromIndexes(key string) {
+	identifier := f.records[key].Identifier
+	f.byIdentifier[identifier] = removeString(f.byIdentifier[identifier], key)
+	if len(f.byIdentifier[identifier]) == 0 {
+		delete(f.byIdentifier, identifier)
+	}
+	f.byDate = removeString(f.byDate, key)
+	delete(f.records, key)
+}
+
+// append writes a single entry to the end of the log and syncs it to disk. On failure the log is truncated back to
+// where the entry started, so that the next entry is not appended after a torn one
+func (f *FileRecordingStore) append(entry fileStoreEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal recording store entry: %v", err)
+	}
+	line = append(line, '\n')
+
+	if f.torn != nil {
+		return fmt.Errorf("recording store %s is closed to writes after a failed write: %v", f.path, f.torn)
+	}
+
+	offset, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("unable to seek recording store %s: %v", f.path, err)
+	}
+
+	_, err = f.file.Write(line)
+	if err != nil {
+		f.rollback(offset)
+		return fmt.Errorf("unable to write to recording store %s: %v", f.path, err)
+	}
+
+	err = f.file.Sync()
+	if err != nil {
+		f.rollback(offset)
+		return fmt.Errorf("unable to sync recording store %s: %v", f.path, err)
+	}
+
+	return nil
+}
+
+// rollback truncates the log back to offset after a failed append. If that also fails no more entries are appended,
+// leaving the torn entry as the final line to be discarded when the log is next opened
+func (f *FileRecordingStore) rollback(offset int64) {
+	err := f.file.Truncate(offset)
+	if err == nil {
+		_, err = f.file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		fmt.Printf("unable to roll back failed write at offset %d of %s: %v\n", offset, f.path, err)
+		f.torn = err
+	}
+}
+
+// compact rewrites the log with only the live records and atomically swaps it into place
+func (f *FileRecordingStore) compact() error {
+	tmpPath := f.path + ".compact"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create compacted recording store %s: %v", tmpPath, err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, key := range f.byDate {
+		line, err2 := json.Marshal(fileStoreEntry{Op: fileStoreOpPut, Record: f.records[key]})
+		if err2 != nil {
+			tmp.Close()
+			return fmt.Errorf("unable to marshal recording store entry: %v", err2)
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write compacted recording store %s: %v", tmpPath, err)
+	}
+
+	err = os.Rename(tmpPath, f.path)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to replace recording store %s: %v", f.path, err)
+	}
+	syncDir(filepath.Dir(f.path))
+
+	f.file.Close()
+	f.file = tmp
+	f.superseded = 0
+
+	_, err = f.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("unable to seek recording store %s: %v", f.path, err)
+	}
+
+	fmt.Printf("compacted recording store %s to %d records\n", f.path, len(f.records))
+
+	return nil
+}
+
+// Close releases the underlying log file
+func (f *FileRecordingStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+func (f *FileRecordingStore) Exists(key RecordKey) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	record, found := f.records[recordKey(key)]
+	return found && record.IsCompleted(), nil
+}
+
+func (f *FileRecordingStore) ExistsBatch(keys []RecordKey) (map[RecordKey]bool, error) {
+	return existsEach(f, keys)
+}
+
+func (f *FileRecordingStore) Claim(key RecordKey, owner string, leaseExpiry time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if existing, found := f.records[recordKey(key)]; found && !existing.IsClaimable(time.Now()) {
+		return false, nil
+	}
+
+	entry := fileStoreEntry{Op: fileStoreOpPut, Record: newClaimRecord(key, owner, leaseExpiry)}
+
+	err := f.append(entry)
+	if err != nil {
+		return false, err
+	}
+	f.apply(entry)
+
+	return true, nil
+}
+
+func (f *FileRecordingStore) Complete(record DBRecord, owner string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if existing, found := f.records[recordKey(record.Key())]; !found || !existing.isClaimedBy(owner) {
+		return false, nil
+	}
+
+	entry := fileStoreEntry{Op: fileStoreOpPut, Record: completedRecord(record, owner)}
+
+	err := f.append(entry)
+	if err != nil {
+		return false, err
+	}
+	f.apply(entry)
+
+	return true, nil
+}
+
+func (f *FileRecordingStore) Put(record DBRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry := fileStoreEntry{Op: fileStoreOpPut, Record: record}
+
+	err := f.append(entry)
+	if err != nil {
+		return err
+	}
+	f.apply(entry)
+
+	return nil
+}
+
+func (f *FileRecordingStore) PutBatch(records []DBRecord) error {
+	return putEach(f, records)
+}
+
+func (f *FileRecordingStore) Delete(key RecordKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record, found := f.records[recordKey(key)]
+	if !found {
+		return nil
+	}
+
+	entry := fileStoreEntry{Op: fileStoreOpDelete, Record: record}
+
+	err := f.append(entry)
+	if err != nil {
+		return err
+	}
+	f.apply(entry)
+
+	return nil
+}
+
+func (f *FileRecordingStore) Get(key RecordKey) (*DBRecord, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	record, found := f.records[recordKey(key)]
+	if !found {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// GetByIdentifier returns every record stored under identifier, sorted by date
+func (f *FileRecordingStore) GetByIdentifier(identifier string) ([]*DBRecord, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var results []*DBRecord
+	for _, key := range f.byIdentifier[identifier] {
+		record := f.records[key]
+		results = append(results, &record)
+	}
+	SortRecordsByDate(results)
+
+	return results, nil
+}
+
+func (f *FileRecordingStore) List(filter RecordingFilter) ([]*DBRecord, error) {
+	var results []*DBRecord
+	err := f.Each(filter, func(record *DBRecord) error {
+		results = append(results, record)
+		return nil
+	})
+	return results, err
+}
+
+// Each walks the date index, passing records to fn sorted by date. fn must not write to the store
+func (f *FileRecordingStore) Each(filter RecordingFilter, fn func(record *DBRecord) error) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	// use the date index to jump straight to the first record within the range
+	start := 0
+	if !filter.From.IsZero() {
+		start = sort.Search(len(f.byDate), func(i int) bool {
+			return !f.records[f.byDate[i]].Date.Before(filter.From)
+		})
+	}
+
+	for _, key := range f.byDate[start:] {
+		record := f.records[key]
+		// and stop at the first record beyond the range
+		if !filter.To.IsZero() && record.Date.After(filter.To) {
+			break
+		}
+		if !filter.Matches(&record) {
+			continue
+		}
+		err := fn(&record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *FileRecordingStore) QueryByDateRange(from, to time.Time) ([]*DBRecord, error) {
+	return f.List(RecordingFilter{From: from, To: to})
+}
+
+// syncDir flushes directory metadata so that a rename survives a crash. Errors are ignored as not all
+// platforms support syncing a directory
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	dir.Sync()
+}
+
+func removeString(slice []string, value string) []string {
+	for i, v := range slice {
+		if v == value {
+			return append(slice[:i], slice[i+1:]...)
+		}
+	}
+	return slice
+}
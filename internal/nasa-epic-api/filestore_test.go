@@ -0,0 +1,116 @@
+package nasa_epic_api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecord(identifier string, date time.Time) DBRecord {
+	key := NewRecordKey(defaultCollection, identifier, date)
+	return DBRecord{RecordID: key.RecordID, Timestamp: key.Timestamp, Identifier: identifier, Date: date}
+}
+
+// writeLog writes a recording store log of a put entry per record followed by trailer
+func writeLog(t *testing.T, path string, records []DBRecord, trailer string) {
+	var log strings.Builder
+	for _, record := range records {
+		line, err := json.Marshal(fileStoreEntry{Op: fileStoreOpPut, Record: record})
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Write(line)
+		log.WriteByte('\n')
+	}
+	log.WriteString(trailer)
+
+	err := ioutil.WriteFile(path, []byte(log.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileRecordingStoreRecoversTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	writeLog(t, path, []DBRecord{testRecord("a", date), testRecord("b", date.Add(time.Hour))}, `{"Op":"put","Rec`)
+
+	store, err := OpenFileRecordingStore(path)
+	if err != nil {
+		t.Fatalf("unable to open store with a torn tail: %v", err)
+	}
+
+	records, _ := store.List(RecordingFilter{})
+	if len(records) != 2 {
+		t.Errorf("expected 2 records after recovery, got %d", len(records))
+	}
+
+	// the torn entry is truncated so that the next write starts on a fresh line
+	err = store.Put(testRecord("c", date.Add(2*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = OpenFileRecordingStore(path)
+	if err != nil {
+		t.Fatalf("unable to reopen store: %v", err)
+	}
+	defer store.Close()
+	records, _ = store.List(RecordingFilter{})
+	if len(records) != 3 {
+		t.Errorf("expected 3 records after reopening, got %d", len(records))
+	}
+}
+
+func TestFileRecordingStoreRecoversCorruptFinalLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	writeLog(t, path, []DBRecord{testRecord("a", date)}, "{not json}\n")
+
+	store, err := OpenFileRecordingStore(path)
+	if err != nil {
+		t.Fatalf("unable to open store with a corrupt final line: %v", err)
+	}
+	defer store.Close()
+
+	records, _ := store.List(RecordingFilter{})
+	if len(records) != 1 {
+		t.Errorf("expected 1 record after recovery, got %d", len(records))
+	}
+}
+
+func TestFileRecordingStoreRejectsMidFileCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+
+	first, _ := json.Marshal(fileStoreEntry{Op: fileStoreOpPut, Record: testRecord("a", date)})
+	last, _ := json.Marshal(fileStoreEntry{Op: fileStoreOpPut, Record: testRecord("b", date.Add(time.Hour))})
+	log := string(first) + "\n{not json}\n" + string(last) + "\n"
+	err := ioutil.WriteFile(path, []byte(log), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenFileRecordingStore(path)
+	if err == nil {
+		t.Fatal("expected an error opening a store corrupted before its final line")
+	}
+
+	// the valid entries after the corruption must be left in place
+	after, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != log {
+		t.Errorf("store was modified on a failed recovery:\n%s", after)
+	}
+
+	if _, err = os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("expected no compacted store to be written")
+	}
+}
@@ -0,0 +1,400 @@
+package nasa_epic_api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// galleryPrefix is the key prefix of every generated month page
+	galleryPrefix = "gallery/"
+	// recordingPagePrefix is the key prefix of every generated recording page
+	recordingPagePrefix = "recordings/"
+	// assetPrefix is the key prefix of every content-hashed asset
+	assetPrefix = "assets/"
+	// legacyFavIconKey is the fixed key the favicon was published to before assets were content-hashed
+	legacyFavIconKey = "favicon.png"
+	// galleryPageRoot is the path from a month page back to the root of the site
+	galleryPageRoot = "../../../"
+
+	// DefaultGalleryPageSize is the number of recordings shown on each month page when not configured
+	DefaultGalleryPageSize = 50
+	// galleryLatestCount is the number of the most recent recordings shown on the landing page
+	galleryLatestCount = 12
+)
+
+// GalleryOptions configures the pages generated by GenerateHTMLIndex
+type GalleryOptions struct {
+	// PageSize is the maximum number of recordings on each month page
+	PageSize int
+	// FeedSize is the number of the most recent recordings in each feed
+	FeedSize int
+	// RSS publishes RSS 2.0 feeds alongside the Atom feeds
+	RSS bool
+	// Theme supplies the page templates and favicon. Defaults to DefaultTheme
+	Theme *Theme
+}
+
+// galleryMonth is a single month of the gallery, as listed on the landing page and month pages
+type galleryMonth struct {
+	Month time.Time
+	Count int
+	Pages int
+	// Key is the key of the month's first page
+	Key string
+}
+
+type galleryYear struct {
+	Year   int
+	Count  int
+	Months []*galleryMonth
+}
+
+type galleryPageLink struct {
+	Number  int
+	Key     string
+	Current bool
+}
+
+type monthDetail struct {
+	Root              string
+	FavIconS3Location string
+	Month             *galleryMonth
+	Previous          *galleryMonth
+	Next              *galleryMonth
+	Page              int
+	PageLinks         []galleryPageLink
+	Records           []*DBRecord
+}
+
+// GenerateHTMLIndex renders the gallery of records and publishes it, with the favicon, to the object store. The
+// gallery is a landing page listing every month with its recording count, one or more pages of recordings for
+// each month, a page for every recording, feeds of the latest recordings and links to the published time-lapses.
+// Pages whose contents are unchanged are not uploaded again, and month and recording pages which are no longer
+// generated, such as after pruning, are deleted. It returns the keys of the objects which were uploaded or deleted
+func GenerateHTMLIndex(records []*DBRecord, objects ObjectStore, opts GalleryOptions) ([]string, error) {
+	DestinationIndexFile := "index.html"
+
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultGalleryPageSize
+	}
+	if opts.Theme == nil {
+		opts.Theme = DefaultTheme()
+	}
+
+	funcs := pageFuncs(objects)
+	index, err := opts.Theme.Template("index", funcs)
+	if err != nil {
+		return nil, err
+	}
+	month, err := opts.Theme.Template("month", funcs)
+	if err != nil {
+		return nil, err
+	}
+	recordingPage, err := opts.Theme.Template("recording", funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := existingObjectHashes(objects, DestinationIndexFile, legacyFavIconKey, assetPrefix, galleryPrefix,
+		recordingPagePrefix, feedPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	publish := func(key string, body []byte, contentType, cacheControl string) error {
+		published, err2 := publishIfChanged(objects, existing, key, body, contentType, cacheControl)
+		if err2 != nil {
+			return err2
+		}
+		if published {
+			changed = append(changed, key)
+		}
+		return nil
+	}
+
+	generated := map[string]bool{}
+
+	// upload favicon to the object store under a key which changes with its contents, so it can be cached forever
+	favIconFile, err := opts.Theme.Asset(favIconAsset)
+	if err != nil {
+		return nil, err
+	}
+	favIcon := contentHashedKey(favIconAsset, favIconFile)
+	generated[favIcon] = true
+	err = publish(favIcon, favIconFile, "image/png", CacheControlImmutable)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload favicon to object store: %v", err)
+	}
+	s3FavLocation := objects.PublicURL(favIcon)
+
+	years, monthRecords := groupRecordsByMonth(records, opts.PageSize)
+
+	var months []*galleryMonth
+	for _, year := range years {
+		months = append(months, year.Months...)
+	}
+
+	for i, m := range months {
+		detail := monthDetail{
+			Root:              galleryPageRoot,
+			FavIconS3Location: s3FavLocation,
+			Month:             m,
+		}
+		// months are listed newest first
+		if i+1 < len(months) {
+			detail.Previous = months[i+1]
+		}
+		if i > 0 {
+			detail.Next = months[i-1]
+		}
+		for page := 1; page <= m.Pages; page++ {
+			detail.PageLinks = append(detail.PageLinks, galleryPageLink{Number: page, Key: galleryPageKey(m.Month, page)})
+		}
+
+		recordsOfMonth := monthRecords[m.Key]
+		for page := 1; page <= m.Pages; page++ {
+			start := (page - 1) * opts.PageSize
+			end := start + opts.PageSize
+			if end > len(recordsOfMonth) {
+				end = len(recordsOfMonth)
+			}
+
+			detail.Page = page
+			detail.Records = recordsOfMonth[start:end]
+			for j := range detail.PageLinks {
+				detail.PageLinks[j].Current = detail.PageLinks[j].Number == page
+			}
+
+			var body bytes.Buffer
+			err = month.Execute(&body, detail)
+			if err != nil {
+				return nil, fmt.Errorf("unable to execute the templating action: %v", err)
+			}
+
+			key := galleryPageKey(m.Month, page)
+			generated[key] = true
+			err = publish(key, body.Bytes(), "text/html", CacheControlShort)
+			if err != nil {
+				return nil, fmt.Errorf("unable to upload gallery page %s to object store: %v", key, err)
+			}
+		}
+	}
+
+	for _, detail := range newRecordingDetails(records, s3FavLocation) {
+		var body bytes.Buffer
+		err = recordingPage.Execute(&body, detail)
+		if err != nil {
+			return nil, fmt.Errorf("unable to execute the templating action: %v", err)
+		}
+
+		key := detail.Record.PageKey()
+		generated[key] = true
+		err = publish(key, body.Bytes(), "text/html", CacheControlShort)
+		if err != nil {
+			return nil, fmt.Errorf("unable to upload recording page %s to object store: %v", key, err)
+		}
+	}
+
+	feeds, feedLinks, err := generateFeeds(records, objects, opts.FeedSize, opts.RSS)
+	if err != nil {
+		return nil, err
+	}
+	for key, body := range feeds {
+		generated[key] = true
+		contentType := "application/atom+xml"
+		if strings.HasSuffix(key, ".rss.xml") {
+			contentType = "application/rss+xml"
+		}
+		err = publish(key, body, contentType, CacheControlShort)
+		if err != nil {
+			return nil, fmt.Errorf("unable to upload feed %s to object store: %v", key, err)
+		}
+	}
+
+	timeLapses, err := listTimeLapses(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make([]*DBRecord, len(records))
+	copy(latest, records)
+	sort.SliceStable(latest, func(i, j int) bool {
+		return latest[i].Date.After(latest[j].Date)
+	})
+	if len(latest) > galleryLatestCount {
+		latest = latest[:galleryLatestCount]
+	}
+
+	recordingDetails := indexDetail{
+		Records:           latest,
+		Total:             len(records),
+		Years:             years,
+		Feeds:             feedLinks,
+		TimeLapses:        timeLapses,
+		FavIconS3Location: s3FavLocation,
+	}
+
+	var indexBody bytes.Buffer
+	err = index.Execute(&indexBody, recordingDetails)
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute the templating action: %v", err)
+	}
+
+	// upload to serve as static hosted website index file
+	err = publish(DestinationIndexFile, indexBody.Bytes(), "text/html", CacheControlShort)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload index file to object store: %v", err)
+	}
+
+	for key := range existing {
+		generatedPage := strings.HasPrefix(key, galleryPrefix) || strings.HasPrefix(key, recordingPagePrefix) ||
+			strings.HasPrefix(key, feedPrefix) || strings.HasPrefix(key, assetPrefix) || key == legacyFavIconKey
+		if !generatedPage || generated[key] {
+			continue
+		}
+		err = objects.Delete(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to delete stale page %s: %v", key, err)
+		}
+		changed = append(changed, key)
+	}
+
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// pageFuncs returns the functions available to page templates
+func pageFuncs(objects ObjectStore) template.FuncMap {
+	return template.FuncMap{
+		"link":     relativeLink,
+		"image":    func(root string, r *DBRecord) string { return relativeLink(root, recordImageURL(r, objects)) },
+		"pageKey":  func(r *DBRecord) string { return r.PageKey() },
+		"size":     formatSize,
+		"distance": func(p Position) string { return fmt.Sprintf("%.0f km", p.Magnitude()) },
+		"position": func(p Position) string { return fmt.Sprintf("%.0f, %.0f, %.0f km", p.X, p.Y, p.Z) },
+	}
+}
+
+// groupRecordsByMonth returns the gallery years and months of records, newest first, and the records of each month,
+// oldest first, keyed on the month's first page key
+func groupRecordsByMonth(records []*DBRecord, pageSize int) ([]*galleryYear, map[string][]*DBRecord) {
+	sorted := make([]*DBRecord, len(records))
+	copy(sorted, records)
+	SortRecordsByDate(sorted)
+
+	monthRecords := map[string][]*DBRecord{}
+	var years []*galleryYear
+
+	// iterate newest first so that years and months are appended in display order
+	for i := len(sorted) - 1; i >= 0; i-- {
+		record := sorted[i]
+		date := record.Date.UTC()
+		monthStart := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		if len(years) == 0 || years[len(years)-1].Year != date.Year() {
+			years = append(years, &galleryYear{Year: date.Year()})
+		}
+		year := years[len(years)-1]
+
+		if len(year.Months) == 0 || !year.Months[len(year.Months)-1].Month.Equal(monthStart) {
+			year.Months = append(year.Months, &galleryMonth{Month: monthStart, Key: galleryPageKey(monthStart, 1)})
+		}
+		month := year.Months[len(year.Months)-1]
+
+		year.Count++
+		month.Count++
+		month.Pages = (month.Count + pageSize - 1) / pageSize
+		monthRecords[month.Key] = append(monthRecords[month.Key], record)
+	}
+
+	for _, recordsOfMonth := range monthRecords {
+		for i, j := 0, len(recordsOfMonth)-1; i < j; i, j = i+1, j-1 {
+			recordsOfMonth[i], recordsOfMonth[j] = recordsOfMonth[j], recordsOfMonth[i]
+		}
+	}
+
+	return years, monthRecords
+}
+
+// galleryPageKey returns the key of a page of a month, e.g. gallery/2006/01/index.html for the first page and
+// gallery/2006/01/page-2.html for the second
+func galleryPageKey(month time.Time, page int) string {
+	if page <= 1 {
+		return fmt.Sprintf("%s%s/index.html", galleryPrefix, month.Format("2006/01"))
+	}
+	return fmt.Sprintf("%s%s/page-%d.html", galleryPrefix, month.Format("2006/01"), page)
+}
+
+// contentHashedKey returns the key of a theme asset named with the hash of its contents, e.g.
+// assets/favicon.3b5d5c3712955042.png for the theme's assets/favicon.png
+func contentHashedKey(name string, body []byte) string {
+	hash := md5.Sum(body)
+	base := path.Base(name)
+	extension := path.Ext(base)
+	return assetPrefix + strings.TrimSuffix(base, extension) + "." + hex.EncodeToString(hash[:8]) + extension
+}
+
+// relativeLink returns target as linked from a page at root. Absolute URLs are returned unchanged, while keys and
+// other relative URLs, as produced by a file object store without a base URL, are prefixed with root
+func relativeLink(root, target string) string {
+	if !isRelativeURL(target) {
+		return target
+	}
+	return root + target
+}
+
+// isRelativeURL reports whether target is relative to the root of the site, such as an object key
+func isRelativeURL(target string) bool {
+	parsed, err := url.Parse(target)
+	return err == nil && !parsed.IsAbs() && !strings.HasPrefix(target, "/")
+}
+
+// recordImageURL returns the URL of a record's image. The stored location is not used for private objects as it
+// may be the bucket's own URL, recorded before the bucket was made private
+func recordImageURL(record *DBRecord, objects ObjectStore) string {
+	if objects != nil && objects.Private() {
+		return objects.PublicURL(record.ObjectKey())
+	}
+	return record.S3Location
+}
+
+// existingObjectHashes returns the MD5 hash of every object whose key starts with one of prefixes
+func existingObjectHashes(objects ObjectStore, prefixes ...string) (map[string]string, error) {
+	hashes := map[string]string{}
+	for _, prefix := range prefixes {
+		listed, err := objects.List(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list objects under %s: %v", prefix, err)
+		}
+		for _, object := range listed {
+			hashes[object.Key] = object.ETag
+		}
+	}
+	return hashes, nil
+}
+
+// publishIfChanged uploads body to key unless existing holds the same hash for key. It reports whether the
+// object was uploaded
+func publishIfChanged(objects ObjectStore, existing map[string]string, key string, body []byte, contentType, cacheControl string) (bool, error) {
+	hash := md5.Sum(body)
+	if existing[key] == hex.EncodeToString(hash[:]) {
+		return false, nil
+	}
+
+	_, err := objects.Put(key, bytes.NewReader(body), contentType, cacheControl)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testMonthRecords returns count records of the region, a day apart from start
+func testMonthRecords(start time.Time, count int) []*DBRecord {
+	var records []*DBRecord
+	for i := 0; i < count; i++ {
+		date := start.AddDate(0, 0, i)
+		record := testRecord(date.Format("20060102150405"), date)
+		record.Region = "default"
+		records = append(records, &record)
+	}
+	return records
+}
+
+func TestGroupRecordsByMonth(t *testing.T) {
+	december := time.Date(2022, 12, 31, 0, 36, 33, 0, time.UTC)
+	january := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	records := append(testMonthRecords(january, 5), testMonthRecords(december, 1)...)
+
+	tests := []struct {
+		pageSize int
+		want     []galleryYear
+	}{
+		{2, []galleryYear{
+			{Year: 2023, Count: 5, Months: []*galleryMonth{{Month: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Count: 5, Pages: 3, Key: "gallery/2023/01/index.html"}}},
+			{Year: 2022, Count: 1, Months: []*galleryMonth{{Month: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), Count: 1, Pages: 1, Key: "gallery/2022/12/index.html"}}},
+		}},
+		{5, []galleryYear{
+			{Year: 2023, Count: 5, Months: []*galleryMonth{{Month: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Count: 5, Pages: 1, Key: "gallery/2023/01/index.html"}}},
+			{Year: 2022, Count: 1, Months: []*galleryMonth{{Month: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), Count: 1, Pages: 1, Key: "gallery/2022/12/index.html"}}},
+		}},
+	}
+
+	for _, test := range tests {
+		years, monthRecords := groupRecordsByMonth(records, test.pageSize)
+
+		var got []galleryYear
+		for _, year := range years {
+			got = append(got, *year)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("page size %d: years %+v, want %+v", test.pageSize, got, test.want)
+		}
+
+		// records of a month are oldest first
+		january := monthRecords["gallery/2023/01/index.html"]
+		for i := 1; i < len(january); i++ {
+			if january[i].Date.Before(january[i-1].Date) {
+				t.Errorf("page size %d: records of January are not sorted oldest first", test.pageSize)
+			}
+		}
+	}
+}
+
+func TestGalleryPageKey(t *testing.T) {
+	month := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		page int
+		want string
+	}{
+		{0, "gallery/2023/01/index.html"},
+		{1, "gallery/2023/01/index.html"},
+		{2, "gallery/2023/01/page-2.html"},
+		{10, "gallery/2023/01/page-10.html"},
+	}
+
+	for _, test := range tests {
+		if got := galleryPageKey(month, test.page); got != test.want {
+			t.Errorf("galleryPageKey(%d) = %q, want %q", test.page, got, test.want)
+		}
+	}
+}
+
+func TestGenerateHTMLIndexPaginatesMonths(t *testing.T) {
+	objects := NewFileObjectStore(t.TempDir(), "")
+	records := testMonthRecords(time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC), 5)
+
+	_, err := GenerateHTMLIndex(records, objects, GalleryOptions{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each page holds the next page size of recordings, oldest first
+	pages := map[string][]*DBRecord{
+		"gallery/2023/01/index.html":  records[0:2],
+		"gallery/2023/01/page-2.html": records[2:4],
+		"gallery/2023/01/page-3.html": records[4:5],
+	}
+	for key, pageRecords := range pages {
+		body, err := objects.Get(key)
+		if err != nil {
+			t.Fatalf("expected page %s to be published: %v", key, err)
+		}
+		page, _ := ioutil.ReadAll(body)
+		body.Close()
+
+		for _, record := range records {
+			listed := strings.Contains(string(page), fmt.Sprintf(`alt="%s"`, record.Identifier))
+			want := false
+			for _, pageRecord := range pageRecords {
+				want = want || pageRecord == record
+			}
+			if listed != want {
+				t.Errorf("page %s lists %s: %t, want %t", key, record.Identifier, listed, want)
+			}
+		}
+	}
+
+	if exists, _ := objects.Exists("gallery/2023/01/page-4.html"); exists {
+		t.Errorf("expected no page beyond the last recording")
+	}
+}
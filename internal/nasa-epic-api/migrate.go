@@ -0,0 +1,195 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	// CurrentSchemaVersion is the DBRecord schema written by this version of the pipeline.
+	// 0: Identifier, FormattedDateStr, ImageSize, S3Location and Date only (records without a SchemaVersion)
+	// 1: adds caption, image, version, collection, coordinates, J2000 positions and the date index attributes
+	// 2: keyed on RecordID and Timestamp instead of Identifier and FormattedDateStr
+	// 3: adds the matched Region and the S3Key of the image
+	// 4: adds the ImageMD5 of the image, backfilled by VerifyRecordings rather than MigrateRecords
+	// 5: adds the Change detected since the previous day, which is only set on newly processed records
+	CurrentSchemaVersion = 5
+)
+
+// applyRecordingMetadata copies the EPIC API metadata of recording onto record and marks it as the current schema version
+func applyRecordingMetadata(record *DBRecord, recording *NasaEpicRecording) {
+	record.SchemaVersion = CurrentSchemaVersion
+	record.Caption = recording.Caption
+	record.Image = recording.Image
+	record.Version = recording.Version
+	record.Collection = recording.Collection
+	record.CentroidCoordinates = recording.CentroidCoordinates
+	record.DscovrPosition = recording.DscovrPosition
+	record.LunarPosition = recording.LunarPosition
+	record.SunPosition = recording.SunPosition
+	applyRecordKey(record)
+}
+
+// applyRecordKey sets the primary key and date index attributes of record from its collection, identifier and date
+func applyRecordKey(record *DBRecord) {
+	if record.Collection == "" {
+		record.Collection = defaultCollection
+	}
+	key := NewRecordKey(record.Collection, record.Identifier, record.Date)
+	record.RecordID = key.RecordID
+	record.Timestamp = key.Timestamp
+	record.DatePartition = record.Date.UTC().Format(datePartitionFormat)
+}
+
+// MigrateRecords brings every record in the store below CurrentSchemaVersion up to date. Missing metadata is
+// re-fetched from the EPIC API, one request per recording day, and the record rewritten in place. Records
+// without a region were all matched by the single region configured at the time, so are assigned regionName.
+// When dryRun is set the records which would be migrated are printed but not written.
+// It returns the number of records migrated
+func MigrateRecords(store RecordingStore, regionName string, dryRun bool) (int, error) {
+	records, err := store.List(RecordingFilter{})
+	if err != nil {
+		return 0, fmt.Errorf("unable to list records: %v", err)
+	}
+
+	// EPIC API responses keyed on the recording day then identifier
+	apiRecordings := map[string]map[string]*NasaEpicRecording{}
+	migrated := 0
+
+	for _, record := range records {
+		if record.SchemaVersion >= CurrentSchemaVersion {
+			continue
+		}
+
+		// the hash and change can only be taken from the images themselves, so records from version 3 onwards
+		// need no metadata
+		if record.SchemaVersion >= 3 {
+			if dryRun {
+				fmt.Printf("Would migrate item %s (%s) from schema version %d to %d\n",
+					record.Identifier, record.FormattedDateStr, record.SchemaVersion, CurrentSchemaVersion)
+			} else {
+				record.SchemaVersion = CurrentSchemaVersion
+				err = store.Put(*record)
+				if err != nil {
+					return migrated, fmt.Errorf("unable to write migrated item %s: %v", record.Identifier, err)
+				}
+			}
+			migrated++
+			continue
+		}
+
+		day := record.Date.UTC().Format("2006-01-02")
+		if _, fetched := apiRecordings[day]; !fetched {
+			recordings, err2 := GetRecordingsForDate(record.Date.UTC())
+			if err2 != nil {
+				return migrated, fmt.Errorf("unable to fetch metadata for %s: %v", day, err2)
+			}
+
+			apiRecordings[day] = map[string]*NasaEpicRecording{}
+			for _, recording := range recordings {
+				apiRecordings[day][recording.Identifier] = recording
+			}
+		}
+
+		recording, found := apiRecordings[day][record.Identifier]
+		if !found {
+			fmt.Printf("Skipping item %s as it is no longer published by the EPIC API\n", record.Identifier)
+			continue
+		}
+
+		fromVersion := record.SchemaVersion
+		applyRecordingMetadata(record, recording)
+		if record.Region == "" {
+			record.Region = regionName
+		}
+		if record.S3Key == "" {
+			record.S3Key = record.ObjectKey()
+		}
+
+		if dryRun {
+			fmt.Printf("Would migrate item %s (%s) from schema version %d to %d\n",
+				record.Identifier, record.FormattedDateStr, fromVersion, record.SchemaVersion)
+		} else {
+			err = store.Put(*record)
+			if err != nil {
+				return migrated, fmt.Errorf("unable to write migrated item %s: %v", record.Identifier, err)
+			}
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// MigrateTableKeys copies every completed record from a table keyed on Identifier and FormattedDateStr into a
+// table keyed on RecordID and Timestamp, then reads the destination back to verify each copied record.
+// Copies are upserts, so the migration can be re-run to pick up records written to the source table while the
+// pipeline was still pointed at it. It returns the number of records copied
+func MigrateTableKeys(client *dynamodb.Client, sourceTable, destinationTable string, scanSegments int, dryRun bool) (int, error) {
+	sourceRecords, err := RetrieveAllItemsAsStruct(client, sourceTable, scanSegments)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read source table %s: %v", sourceTable, err)
+	}
+
+	var records []DBRecord
+	for _, record := range sourceRecords {
+		if !record.IsCompleted() {
+			fmt.Printf("Skipping in-progress item %s\n", record.Identifier)
+			continue
+		}
+
+		applyRecordKey(record)
+		// version 1 records only lacked the new key, later versions are left to MigrateRecords
+		if record.SchemaVersion == 1 {
+			record.SchemaVersion = 2
+		}
+
+		if dryRun {
+			fmt.Printf("Would copy item %s (%s) as %s/%s\n", record.Identifier, record.FormattedDateStr, record.RecordID, record.Timestamp)
+		}
+		records = append(records, *record)
+	}
+
+	if dryRun || len(records) == 0 {
+		return len(records), nil
+	}
+
+	err = WriteDBItems(client, records, destinationTable)
+	if err != nil {
+		return 0, fmt.Errorf("unable to write to destination table %s: %v", destinationTable, err)
+	}
+
+	// verify every copied record can be read back unchanged from the destination
+	destinationRecords, err := RetrieveAllItemsAsStruct(client, destinationTable, scanSegments)
+	if err != nil {
+		return len(records), fmt.Errorf("unable to read destination table %s for verification: %v", destinationTable, err)
+	}
+
+	copied := map[RecordKey]*DBRecord{}
+	for _, record := range destinationRecords {
+		copied[record.Key()] = record
+	}
+
+	mismatches := 0
+	for _, record := range records {
+		destination, found := copied[record.Key()]
+		switch {
+		case !found:
+			fmt.Printf("Verification failed: item %s is missing from %s\n", record.RecordID, destinationTable)
+			mismatches++
+		case destination.Identifier != record.Identifier || destination.S3Location != record.S3Location ||
+			destination.ImageSize != record.ImageSize || !destination.Date.Equal(record.Date):
+			fmt.Printf("Verification failed: item %s differs in %s\n", record.RecordID, destinationTable)
+			mismatches++
+		}
+	}
+
+	if mismatches > 0 {
+		return len(records), fmt.Errorf("%d of %d copied items failed verification", mismatches, len(records))
+	}
+
+	fmt.Printf("Verified %d items in %s\n", len(records), destinationTable)
+
+	return len(records), nil
+}
@@ -0,0 +1,440 @@
+package nasa_epic_api
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ObjectStore holds the images and pages published by the pipeline. Keys are slash separated paths relative to
+// the root of the published site
+type ObjectStore interface {
+	// Put writes an object, replacing any existing object, and returns its public URL. cacheControl is the
+	// Cache-Control header the object is served with, see CacheControlImmutable and CacheControlShort
+	Put(key string, body io.Reader, contentType, cacheControl string) (string, error)
+	// Get returns the body of an object, which the caller must close
+	Get(key string) (io.ReadCloser, error)
+	Exists(key string) (bool, error)
+	// Delete removes an object. Deleting a missing object is not an error
+	Delete(key string) error
+	// List returns every object whose key starts with prefix, ordered by key
+	List(prefix string) ([]ObjectInfo, error)
+	// SetCacheControl replaces the Cache-Control header of an existing object without rewriting its body. It
+	// reports whether the header was changed
+	SetCacheControl(key, cacheControl string) (bool, error)
+	// PublicURL returns the URL an object is served from
+	PublicURL(key string) string
+	// Private reports whether objects can only be read through an authenticated gateway at the base URL, or by
+	// presigned URLs
+	Private() bool
+	// PresignedURL returns a URL which allows anyone holding it to read a private object until it expires, for
+	// links opened outside of the gateway such as those in the email report. Other objects are returned by PublicURL
+	PresignedURL(key string) (string, error)
+}
+
+const (
+	// CacheControlImmutable is served with objects whose key changes whenever their contents do, such as
+	// content-hashed assets
+	CacheControlImmutable = "public, max-age=31536000, immutable"
+	// CacheControlStable is served with objects under fixed keys which are not expected to change but may be
+	// rewritten, such as recording and diff images. Caches revalidate them by ETag once a day
+	CacheControlStable = "public, max-age=86400"
+	// CacheControlShort is served with objects which are rewritten in place, such as pages, feeds and the catalogue
+	CacheControlShort = "public, max-age=300"
+
+	// DefaultPresignExpiry is how long presigned URLs are valid for when not configured, which is also the longest
+	// S3 allows. URLs signed with temporary credentials expire with them if sooner
+	DefaultPresignExpiry = 7 * 24 * time.Hour
+)
+
+// ObjectInfo describes a single object listed from an ObjectStore
+type ObjectInfo struct {
+	Key  string
+	Size int64
+	// ETag is the hex MD5 hash of the object, unless it was uploaded to S3 in multiple parts
+	ETag string
+}
+
+// ObjectStoreConfig selects and configures an ObjectStore backend
+type ObjectStoreConfig struct {
+	Backend string
+	Bucket  string
+	// AWS configures the S3 client
+	AWS AWSClientConfig
+	// Directory is the root of the site written by the file backend
+	Directory string
+	// BaseURL, if set, is prefixed to keys to form public URLs in place of the backend's own URLs
+	BaseURL string
+	// Private is set when the bucket is not publicly readable. BaseURL must then be an authenticated gateway in front
+	// of the bucket, which the pages link through, while the email report links to objects by presigned URLs valid
+	// for PresignExpiry
+	Private       bool
+	PresignExpiry time.Duration
+}
+
+// NewObjectStore returns the ObjectStore for the configured backend
+func NewObjectStore(cfg ObjectStoreConfig) (ObjectStore, error) {
+	switch cfg.Backend {
+	case "", "s3":
+		client, err := CreateS3Client(cfg.AWS)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Private {
+			// pages are stored with their links, so cannot link by presigned URLs which change on every run and expire
+			if cfg.BaseURL == "" {
+				return nil, fmt.Errorf("a private bucket must be served through an authenticated gateway set as the base URL")
+			}
+			expiry := cfg.PresignExpiry
+			if expiry <= 0 {
+				expiry = DefaultPresignExpiry
+			}
+			if expiry > DefaultPresignExpiry {
+				return nil, fmt.Errorf("presigned URLs cannot be valid for longer than %v", DefaultPresignExpiry)
+			}
+			expires, err2 := credentialsExpiry(cfg.AWS)
+			if err2 == nil && !expires.IsZero() && expires.Before(time.Now().Add(expiry)) {
+				fmt.Printf("presigned URLs will expire with the credentials signing them at %v rather than after %v\n", expires, expiry)
+			}
+			return NewPrivateS3ObjectStore(client, cfg.Bucket, cfg.BaseURL, expiry), nil
+		}
+		baseURL := cfg.BaseURL
+		if baseURL == "" {
+			baseURL = s3BucketURL(cfg.Bucket, cfg.AWS)
+		}
+		return NewS3ObjectStore(client, cfg.Bucket, baseURL), nil
+	case "file":
+		if cfg.Directory == "" {
+			return nil, fmt.Errorf("a directory must be set for the file object store")
+		}
+		if cfg.Private {
+			return nil, fmt.Errorf("private mode is only supported by the s3 object store")
+		}
+		return NewFileObjectStore(cfg.Directory, cfg.BaseURL), nil
+	default:
+		return nil, fmt.Errorf("unknown object store backend: %s", cfg.Backend)
+	}
+}
+
+// S3ObjectStore is an ObjectStore backed by an S3 bucket
+type S3ObjectStore struct {
+	client  *s3.Client
+	bucket  string
+	baseURL string
+	// presignExpiry, if set, is how long the URLs returned by PresignedURL are valid for, as the bucket is private
+	presignExpiry time.Duration
+}
+
+// NewS3ObjectStore returns an S3ObjectStore for bucket whose objects are served from baseURL
+func NewS3ObjectStore(client *s3.Client, bucket, baseURL string) *S3ObjectStore {
+	return &S3ObjectStore{client: client, bucket: bucket, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// NewPrivateS3ObjectStore returns an S3ObjectStore for a private bucket served through an authenticated gateway at
+// baseURL, whose objects are also linked by presigned URLs valid for expiry
+func NewPrivateS3ObjectStore(client *s3.Client, bucket, baseURL string, expiry time.Duration) *S3ObjectStore {
+	return &S3ObjectStore{client: client, bucket: bucket, baseURL: strings.TrimSuffix(baseURL, "/"), presignExpiry: expiry}
+}
+
+func (s *S3ObjectStore) Put(key string, body io.Reader, contentType, cacheControl string) (string, error) {
+	// objects of a private bucket must not be kept by shared caches
+	if s.Private() {
+		cacheControl = strings.Replace(cacheControl, "public", "private", 1)
+	}
+
+	_, err := UploadS3Object(s.client, body, s.bucket, key, contentType, cacheControl)
+	if err != nil {
+		return "", err
+	}
+	return s.baseURL + "/" + key, nil
+}
+
+func (s *S3ObjectStore) Get(key string) (io.ReadCloser, error) {
+	return GetS3Object(s.client, s.bucket, key)
+}
+
+func (s *S3ObjectStore) Exists(key string) (bool, error) {
+	return CheckIfS3ObjectExists(s.client, s.bucket, key)
+}
+
+func (s *S3ObjectStore) Delete(key string) error {
+	return DeleteS3Object(s.client, s.bucket, key)
+}
+
+func (s *S3ObjectStore) List(prefix string) ([]ObjectInfo, error) {
+	return ListS3Objects(s.client, s.bucket, prefix)
+}
+
+func (s *S3ObjectStore) SetCacheControl(key, cacheControl string) (bool, error) {
+	if s.Private() {
+		cacheControl = strings.Replace(cacheControl, "public", "private", 1)
+	}
+	return SetS3ObjectCacheControl(s.client, s.bucket, key, cacheControl)
+}
+
+func (s *S3ObjectStore) PublicURL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+func (s *S3ObjectStore) Private() bool {
+	return s.presignExpiry > 0
+}
+
+func (s *S3ObjectStore) PresignedURL(key string) (string, error) {
+	if !s.Private() {
+		return s.PublicURL(key), nil
+	}
+	return PresignS3Object(s.client, s.bucket, key, s.presignExpiry)
+}
+
+// s3BucketURL returns the URL of a bucket, addressed in the same way as the S3 client configured by clientConfig
+func s3BucketURL(bucket string, clientConfig AWSClientConfig) string {
+	if clientConfig.EndpointURL == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, clientConfig.Region)
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(clientConfig.EndpointURL, "/"))
+	if err != nil || clientConfig.UsePathStyle {
+		return strings.TrimSuffix(clientConfig.EndpointURL, "/") + "/" + bucket
+	}
+	endpoint.Host = bucket + "." + endpoint.Host
+	return endpoint.String()
+}
+
+// FileObjectStore is an ObjectStore which writes objects beneath a local directory. The directory is a static
+// site which can be served by any web server, or opened from disk when no base URL is set as public URLs are then
+// relative to the root of the site
+type FileObjectStore struct {
+	directory string
+	baseURL   string
+}
+
+// NewFileObjectStore returns a FileObjectStore rooted at directory
+func NewFileObjectStore(directory, baseURL string) *FileObjectStore {
+	return &FileObjectStore{directory: directory, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Put writes the object to a temporary file first and renames it into place, so a failed write never leaves a
+// partial object. The content type is implied by the key's extension and caching is left to the web server
+func (f *FileObjectStore) Put(key string, body io.Reader, contentType, cacheControl string) (string, error) {
+	filePath := f.path(key)
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	// temporary files are created private
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmp.Name(), filePath)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("wrote object %s to %s\n", key, f.directory)
+
+	return f.PublicURL(key), nil
+}
+
+func (f *FileObjectStore) Get(key string) (io.ReadCloser, error) {
+	return os.Open(f.path(key))
+}
+
+func (f *FileObjectStore) Exists(key string) (bool, error) {
+	_, err := os.Stat(f.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes the object and any directories left empty by its removal
+func (f *FileObjectStore) Delete(key string) error {
+	err := os.Remove(f.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for dir := path.Dir(key); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		// fails once a directory is not empty
+		if os.Remove(f.path(dir)) != nil {
+			break
+		}
+	}
+
+	fmt.Printf("deleted object %s from %s\n", key, f.directory)
+
+	return nil
+}
+
+func (f *FileObjectStore) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	err := filepath.Walk(f.directory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == f.directory {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		relative, err := filepath.Rel(f.directory, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		etag, err := hashFile(filePath)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ETag: etag})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+// SetCacheControl does nothing, as caching of the site is left to the web server serving it
+func (f *FileObjectStore) SetCacheControl(key, cacheControl string) (bool, error) {
+	return false, nil
+}
+
+func (f *FileObjectStore) PublicURL(key string) string {
+	if f.baseURL == "" {
+		return key
+	}
+	return f.baseURL + "/" + key
+}
+
+func (f *FileObjectStore) Private() bool {
+	return false
+}
+
+func (f *FileObjectStore) PresignedURL(key string) (string, error) {
+	return f.PublicURL(key), nil
+}
+
+// path returns the file path of key, which cannot escape the store's directory
+func (f *FileObjectStore) path(key string) string {
+	return filepath.Join(f.directory, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// InvalidationPaths returns the sorted and de-duplicated paths of the objects at keys, as given to a CDN to
+// invalidate its cached copies, e.g. /gallery/2023/01/index.html
+func InvalidationPaths(keys []string) []string {
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		paths = append(paths, "/"+key)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// CacheControlForKey returns the Cache-Control header an object is published with, judged from its key
+func CacheControlForKey(key string) string {
+	switch {
+	case strings.HasPrefix(key, assetPrefix):
+		return CacheControlImmutable
+	case strings.HasSuffix(key, ".png"):
+		return CacheControlStable
+	default:
+		return CacheControlShort
+	}
+}
+
+// BackfillCacheControl sets the Cache-Control header of every object published before headers were set on upload,
+// or under an earlier policy, to that of CacheControlForKey. When dryRun is set the header each object would be given
+// is printed but nothing is changed. It returns the keys of the objects whose header was changed
+func BackfillCacheControl(objects ObjectStore, dryRun bool) ([]string, error) {
+	listed, err := objects.List("")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list objects: %v", err)
+	}
+
+	var changed []string
+	for _, object := range listed {
+		cacheControl := CacheControlForKey(object.Key)
+		if dryRun {
+			fmt.Printf("Would set Cache-Control of object %s to %s\n", object.Key, cacheControl)
+			continue
+		}
+
+		updated, err2 := objects.SetCacheControl(object.Key, cacheControl)
+		if err2 != nil {
+			return changed, fmt.Errorf("unable to set Cache-Control of object %s: %v", object.Key, err2)
+		}
+		if updated {
+			changed = append(changed, object.Key)
+		}
+	}
+
+	return changed, nil
+}
+
+// hashFile returns the hex MD5 hash of a file, which matches the ETag S3 gives objects uploaded in a single part
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
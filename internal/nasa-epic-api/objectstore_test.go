@@ -0,0 +1,87 @@
+package nasa_epic_api
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileObjectStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	objects := NewFileObjectStore(dir, "")
+
+	body := "png"
+	for _, key := range []string{"2023-01-01/a.png", "2023-01-01/b.png", "index.html"} {
+		location, err := objects.Put(key, strings.NewReader(body), "", CacheControlShort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location != key {
+			t.Errorf("expected the location of %s without a base URL to be its key, got %s", key, location)
+		}
+	}
+
+	reader, err := objects.Get("2023-01-01/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(reader)
+	reader.Close()
+	if string(got) != body {
+		t.Errorf("Get returned %q, want %q", got, body)
+	}
+
+	hash := md5.Sum([]byte(body))
+	listed, err := objects.List("2023-01-01/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ObjectInfo{
+		{Key: "2023-01-01/a.png", Size: 3, ETag: hex.EncodeToString(hash[:])},
+		{Key: "2023-01-01/b.png", Size: 3, ETag: hex.EncodeToString(hash[:])},
+	}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("List returned %+v, want %+v", listed, want)
+	}
+
+	for _, key := range []string{"2023-01-01/a.png", "2023-01-01/b.png", "2023-01-01/missing.png"} {
+		err = objects.Delete(key)
+		if err != nil {
+			t.Errorf("unable to delete %s: %v", key, err)
+		}
+	}
+	if exists, _ := objects.Exists("2023-01-01/a.png"); exists {
+		t.Errorf("expected the deleted object to no longer exist")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "2023-01-01")); !os.IsNotExist(err) {
+		t.Errorf("expected the emptied directory to be removed")
+	}
+}
+
+func TestFileObjectStoreURLs(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		baseURL string
+		key     string
+		want    string
+	}{
+		{"", "gallery/2023/01/index.html", "gallery/2023/01/index.html"},
+		{"https://example.com/site/", "index.html", "https://example.com/site/index.html"},
+	}
+	for _, test := range tests {
+		if got := NewFileObjectStore(dir, test.baseURL).PublicURL(test.key); got != test.want {
+			t.Errorf("PublicURL(%q) with base %q = %q, want %q", test.key, test.baseURL, got, test.want)
+		}
+	}
+
+	// keys cannot escape the store's directory
+	if got := NewFileObjectStore(dir, "").path("../../etc/passwd"); got != filepath.Join(dir, "etc", "passwd") {
+		t.Errorf("expected the key to be confined to the store's directory, got %s", got)
+	}
+}
@@ -0,0 +1,119 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// recordingPageRoot is the path from a recording page back to the root of the site
+const recordingPageRoot = "../../"
+
+// recordingPageDetail is the data of a single recording page
+type recordingPageDetail struct {
+	Root              string
+	FavIconS3Location string
+	Record            *DBRecord
+	// Previous and Next are the neighbouring recordings of the same region, if any
+	Previous   *DBRecord
+	Next       *DBRecord
+	ArchiveURL string
+	// MonthKey is the key of the first gallery page of the recording's month
+	MonthKey string
+}
+
+// PageKey returns the key of the record's detail page, e.g. recordings/natural/20230101003633.html
+func (r *DBRecord) PageKey() string {
+	collection, identifier := splitRecordID(r.Key().RecordID)
+	return recordingPageKey(collection, identifier)
+}
+
+// PageKey returns the key of the recording's detail page
+func (r *NasaEpicRecording) PageKey() string {
+	collection := r.Collection
+	if collection == "" {
+		collection = defaultCollection
+	}
+	return recordingPageKey(collection, r.Identifier)
+}
+
+func recordingPageKey(collection, identifier string) string {
+	return fmt.Sprintf("%s%s/%s.html", recordingPagePrefix, collection, identifier)
+}
+
+// ArchiveURL returns the URL of the record's original image in the EPIC archive, or an empty string for records
+// written before the image name was stored
+func (r *DBRecord) ArchiveURL() string {
+	if r.Image == "" {
+		return ""
+	}
+	collection := r.Collection
+	if collection == "" {
+		collection = defaultCollection
+	}
+	return archiveImageURL(collection, r.Date.UTC(), r.Image)
+}
+
+// ThumbnailURL returns the URL of the record's thumbnail in the EPIC archive, or an empty string for records
+// written before the image name was stored
+func (r *DBRecord) ThumbnailURL() string {
+	if r.Image == "" {
+		return ""
+	}
+	collection := r.Collection
+	if collection == "" {
+		collection = defaultCollection
+	}
+	return archiveThumbnailURL(collection, r.Date.UTC(), r.Image)
+}
+
+// Magnitude returns the distance of the position from the origin in kilometres
+func (p Position) Magnitude() float64 {
+	return math.Sqrt(p.X*p.X + p.Y*p.Y + p.Z*p.Z)
+}
+
+// newRecordingDetails returns the page data of every record, linking each to the previous and next recordings of
+// the same region
+func newRecordingDetails(records []*DBRecord, favIconLocation string) []recordingPageDetail {
+	var details []recordingPageDetail
+
+	for _, regionRecords := range groupRecordsByRegion(records) {
+		SortRecordsByDate(regionRecords)
+
+		for i, record := range regionRecords {
+			date := record.Date.UTC()
+			detail := recordingPageDetail{
+				Root:              recordingPageRoot,
+				FavIconS3Location: favIconLocation,
+				Record:            record,
+				ArchiveURL:        record.ArchiveURL(),
+				MonthKey:          galleryPageKey(time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC), 1),
+			}
+			if i > 0 {
+				detail.Previous = regionRecords[i-1]
+			}
+			if i+1 < len(regionRecords) {
+				detail.Next = regionRecords[i+1]
+			}
+			details = append(details, detail)
+		}
+	}
+
+	return details
+}
+
+// formatSize returns a number of bytes in human readable form, e.g. 2.4 MB
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + units[unit]
+}
@@ -0,0 +1,179 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy decides which records, and their images, are pruned. Zero values disable each rule
+type RetentionPolicy struct {
+	// MaxAge prunes records recorded longer ago than this
+	MaxAge time.Duration
+	// MaxCountPerRegion prunes all but the most recent records of each region
+	MaxCountPerRegion int
+	// KeepBest always retains this many of the best records of each region, regardless of the rules above.
+	// The best records are those taken closest to local solar noon
+	KeepBest int
+}
+
+// Enabled reports whether the policy would ever prune anything
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxCountPerRegion > 0
+}
+
+// ObjectKey returns the S3 key of the record's image. Records written before S3Key was stored have it derived
+// from the path of their S3Location, less the bucket where the location is a path-style URL
+func (r *DBRecord) ObjectKey() string {
+	if r.S3Key != "" {
+		return r.S3Key
+	}
+
+	location, err := url.Parse(r.S3Location)
+	if err == nil && location.Path != "" {
+		key := strings.TrimPrefix(location.Path, "/")
+		if isPathStyleS3Host(location.Hostname()) {
+			key = key[strings.Index(key, "/")+1:]
+		}
+		return key
+	}
+
+	if r.Image != "" {
+		return r.Date.Format("2006-01-02") + "/" + r.Image + ".png"
+	}
+	return ""
+}
+
+// isPathStyleS3Host reports whether host is an S3 endpoint addressing buckets in the path, such as
+// s3.eu-west-1.amazonaws.com, rather than a bucket's own virtual-hosted name such as
+// bucket.s3.eu-west-1.amazonaws.com
+func isPathStyleS3Host(host string) bool {
+	return strings.HasSuffix(host, ".amazonaws.com") && (strings.HasPrefix(host, "s3.") || strings.HasPrefix(host, "s3-"))
+}
+
+// SelectRecordsToPrune returns the records which policy does not retain as of now
+func SelectRecordsToPrune(records []*DBRecord, policy RetentionPolicy, now time.Time) []*DBRecord {
+	var prune []*DBRecord
+
+	for _, regionRecords := range groupRecordsByRegion(records) {
+		keep := map[*DBRecord]bool{}
+
+		// the best records are kept first so that they do not count towards MaxCountPerRegion
+		best := make([]*DBRecord, len(regionRecords))
+		copy(best, regionRecords)
+		sort.SliceStable(best, func(i, j int) bool {
+			return solarNoonDistance(best[i]) < solarNoonDistance(best[j])
+		})
+		for i := 0; i < policy.KeepBest && i < len(best); i++ {
+			keep[best[i]] = true
+		}
+
+		// newest first
+		sort.SliceStable(regionRecords, func(i, j int) bool {
+			return regionRecords[i].Date.After(regionRecords[j].Date)
+		})
+
+		kept := 0
+		for _, record := range regionRecords {
+			if keep[record] {
+				continue
+			}
+
+			tooOld := policy.MaxAge > 0 && now.Sub(record.Date) > policy.MaxAge
+			tooMany := policy.MaxCountPerRegion > 0 && kept >= policy.MaxCountPerRegion
+			if tooOld || tooMany {
+				prune = append(prune, record)
+			} else {
+				kept++
+			}
+		}
+	}
+
+	SortRecordsByDate(prune)
+
+	return prune
+}
+
+// PruneRecordings deletes the records and images which policy does not retain. Each record is deleted before its
+// images so that a failure never leaves a record pointing at a deleted image, only an orphaned image which the
+// verify command reports. When dryRun is set the records and objects which would be deleted are printed but nothing
+// is deleted. It returns the records selected for pruning
+func PruneRecordings(store RecordingStore, objects ObjectStore, policy RetentionPolicy, dryRun bool) ([]*DBRecord, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+
+	records, err := store.List(RecordingFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records: %v", err)
+	}
+
+	prune := SelectRecordsToPrune(records, policy, time.Now())
+
+	for _, record := range prune {
+		objectKeys := prunedObjectKeys(record)
+
+		if dryRun {
+			fmt.Printf("Would delete item %s (%s, region %s) and objects %s\n",
+				record.Identifier, record.FormattedDateStr, record.Region, strings.Join(objectKeys, ", "))
+			continue
+		}
+
+		err = store.Delete(record.Key())
+		if err != nil {
+			return nil, fmt.Errorf("unable to delete item %s: %v", record.Identifier, err)
+		}
+
+		for _, objectKey := range objectKeys {
+			err = objects.Delete(objectKey)
+			if err != nil {
+				return nil, fmt.Errorf("unable to delete object %s: %v", objectKey, err)
+			}
+		}
+		fmt.Printf("Pruned item %s (%s, region %s)\n", record.Identifier, record.FormattedDateStr, record.Region)
+	}
+
+	return prune, nil
+}
+
+// prunedObjectKeys returns the keys of every object deleted along with the record: its image and any diff image
+func prunedObjectKeys(record *DBRecord) []string {
+	candidates := []string{record.ObjectKey()}
+	if record.Change != nil {
+		candidates = append(candidates, record.Change.DiffKey)
+	}
+
+	var objectKeys []string
+	for _, objectKey := range candidates {
+		if objectKey != "" {
+			objectKeys = append(objectKeys, objectKey)
+		}
+	}
+	return objectKeys
+}
+
+// groupRecordsByRegion returns the records of each region
+func groupRecordsByRegion(records []*DBRecord) map[string][]*DBRecord {
+	groups := map[string][]*DBRecord{}
+	for _, record := range records {
+		groups[record.Region] = append(groups[record.Region], record)
+	}
+	return groups
+}
+
+// solarNoonDistance returns how far the record's local solar time is from noon. Records without a local solar
+// time are ranked last
+func solarNoonDistance(record *DBRecord) time.Duration {
+	localSolarTime, err := time.Parse(localSolarTimeFormat, record.LocalSolarTime)
+	if err != nil {
+		return math.MaxInt64
+	}
+	distance := timeOfDay(localSolarTime) - 12*time.Hour
+	if distance < 0 {
+		return -distance
+	}
+	return distance
+}
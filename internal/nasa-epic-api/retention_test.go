@@ -0,0 +1,90 @@
+package nasa_epic_api
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestObjectKey(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	tests := []struct {
+		name   string
+		record DBRecord
+		want   string
+	}{
+		{"stored key", DBRecord{S3Key: "2023-01-01/a.png", S3Location: "https://other/b.png"}, "2023-01-01/a.png"},
+		{"virtual-hosted location", DBRecord{S3Location: "https://bucket.s3.eu-west-1.amazonaws.com/2023-01-01/a.png"}, "2023-01-01/a.png"},
+		{"path-style location", DBRecord{S3Location: "https://s3.eu-west-1.amazonaws.com/bucket/2023-01-01/a.png"}, "2023-01-01/a.png"},
+		{"legacy path-style location", DBRecord{S3Location: "https://s3-eu-west-1.amazonaws.com/bucket/2023-01-01/a.png"}, "2023-01-01/a.png"},
+		{"global path-style location", DBRecord{S3Location: "https://s3.amazonaws.com/bucket.with.dots/2023-01-01/a.png"}, "2023-01-01/a.png"},
+		{"image name", DBRecord{Image: "a", Date: date}, "2023-01-01/a.png"},
+		{"unknown", DBRecord{}, ""},
+	}
+
+	for _, test := range tests {
+		if got := test.record.ObjectKey(); got != test.want {
+			t.Errorf("%s: ObjectKey() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSelectRecordsToPrune(t *testing.T) {
+	now := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	// five records of region a, one a day, the oldest taken closest to local solar noon, and an old record of region b
+	var records []*DBRecord
+	solarTimes := []string{"10:00", "14:30", "09:30", "", "12:05"}
+	for i, solarTime := range solarTimes {
+		record := testRecord(string(rune('1'+i)), now.AddDate(0, 0, -(i+1)))
+		record.Region = "a"
+		record.LocalSolarTime = solarTime
+		records = append(records, &record)
+	}
+	other := testRecord("b", now.AddDate(0, 0, -30))
+	other.Region = "b"
+	records = append(records, &other)
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{"disabled", RetentionPolicy{}, nil},
+		{"max age", RetentionPolicy{MaxAge: 72 * time.Hour}, []string{"b", "5", "4"}},
+		{"max count per region", RetentionPolicy{MaxCountPerRegion: 2}, []string{"5", "4", "3"}},
+		{"keep best outside max count", RetentionPolicy{MaxCountPerRegion: 2, KeepBest: 1}, []string{"4", "3"}},
+		{"keep best outside max age per region", RetentionPolicy{MaxAge: 72 * time.Hour, KeepBest: 2}, []string{"4"}},
+		{"keep best ranks missing solar time last", RetentionPolicy{MaxCountPerRegion: 1, KeepBest: 4}, nil},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, record := range SelectRecordsToPrune(records, test.policy, now) {
+			got = append(got, record.Identifier)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: pruned %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSolarNoonDistance(t *testing.T) {
+	tests := []struct {
+		localSolarTime string
+		want           time.Duration
+	}{
+		{"12:00", 0},
+		{"11:15", 45 * time.Minute},
+		{"13:30", 90 * time.Minute},
+		{"", math.MaxInt64},
+		{"invalid", math.MaxInt64},
+	}
+
+	for _, test := range tests {
+		if got := solarNoonDistance(&DBRecord{LocalSolarTime: test.localSolarTime}); got != test.want {
+			t.Errorf("solarNoonDistance(%q) = %v, want %v", test.localSolarTime, got, test.want)
+		}
+	}
+}
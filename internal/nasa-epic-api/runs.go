@@ -0,0 +1,343 @@
+package nasa_epic_api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NotificationStatusNone   = "none"
+	NotificationStatusSent   = "sent"
+	NotificationStatusFailed = "failed"
+)
+
+// RunStore persists the RunRecord of every invocation of the pipeline
+type RunStore interface {
+	// PutRun writes the run, replacing any existing run with the same RunID
+	PutRun(run RunRecord) error
+	// GetRun returns the run with the RunID, or nil if not found
+	GetRun(runID string) (*RunRecord, error)
+	// ListRuns returns up to limit runs, most recent first. A limit of 0 returns all runs
+	ListRuns(limit int) ([]*RunRecord, error)
+	// GetWatermark returns the last fully processed recording date of the collection and region, or the zero
+	// time if none has been recorded
+	GetWatermark(collection, region string) (time.Time, error)
+	// PutWatermark records the last fully processed recording date of the collection and region
+	PutWatermark(collection, region string, date time.Time) error
+}
+
+// NewRunStore returns the RunStore for the configured backend. The file backend keeps runs in a second log
+// alongside the recordings log
+func NewRunStore(cfg RecordingStoreConfig) (RunStore, error) {
+	switch cfg.Backend {
+	case "", "dynamodb":
+		if cfg.RunsTableName == "" {
+			return nil, fmt.Errorf("a runs table name must be set for the dynamodb run store")
+		}
+		client, err := CreateDBClient(cfg.AWS)
+		if err != nil {
+			return nil, err
+		}
+		return NewDynamoDBRunStore(client, cfg.RunsTableName), nil
+	case "file":
+		if cfg.FilePath == "" {
+			return nil, fmt.Errorf("a file path must be set for the file run store")
+		}
+		return NewFileRunStore(strings.TrimSuffix(cfg.FilePath, filepath.Ext(cfg.FilePath))+"-runs.jsonl",
+			strings.TrimSuffix(cfg.FilePath, filepath.Ext(cfg.FilePath))+"-watermarks.json"), nil
+	case "memory":
+		return NewMemoryRunStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown run store backend: %s", cfg.Backend)
+	}
+}
+
+// NewRunRecord starts the RunRecord of a run
+func NewRunRecord(runID string) *RunRecord {
+	return &RunRecord{
+		RunID:              runID,
+		StartTime:          time.Now().UTC(),
+		NotificationStatus: NotificationStatusNone,
+	}
+}
+
+// AddError records a failure of the run
+func (r *RunRecord) AddError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// Duration returns how long the run took, or has taken so far if it has not ended
+func (r *RunRecord) Duration() time.Duration {
+	if r.EndTime.IsZero() {
+		return time.Since(r.StartTime)
+	}
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// sortRunsByStartTime sorts runs in place, most recent first, and truncates to limit
+func sortRunsByStartTime(runs []*RunRecord, limit int) []*RunRecord {
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartTime.After(runs[j].StartTime)
+	})
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs
+}
+
+// MemoryRunStore is a RunStore held in memory. Runs are lost when the process exits
+type MemoryRunStore struct {
+	mu         sync.RWMutex
+	runs       map[string]RunRecord
+	watermarks map[string]time.Time
+}
+
+func NewMemoryRunStore() *MemoryRunStore {
+	return &MemoryRunStore{
+		runs:       map[string]RunRecord{},
+		watermarks: map[string]time.Time{},
+	}
+}
+
+func (m *MemoryRunStore) PutRun(run RunRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runs[run.RunID] = run
+	return nil
+}
+
+func (m *MemoryRunStore) GetRun(runID string) (*RunRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run, found := m.runs[runID]
+	if !found {
+		return nil, nil
+	}
+	return &run, nil
+}
+
+func (m *MemoryRunStore) ListRuns(limit int) ([]*RunRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var runs []*RunRecord
+	for _, run := range m.runs {
+		run := run
+		runs = append(runs, &run)
+	}
+
+	return sortRunsByStartTime(runs, limit), nil
+}
+
+func (m *MemoryRunStore) GetWatermark(collection, region string) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.watermarks[watermarkID(collection, region)], nil
+}
+
+func (m *MemoryRunStore) PutWatermark(collection, region string, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.watermarks[watermarkID(collection, region)] = date
+	return nil
+}
+
+// FileRunStore is a RunStore persisted to an append-only JSON Lines log on local disk. The last entry written
+// for a RunID wins. Runs are few and small, so the log is read in full on every lookup.
+// Watermarks are kept in a separate JSON file which is replaced atomically on every update
+type FileRunStore struct {
+	mu             sync.Mutex
+	path           string
+	watermarksPath string
+}
+
+func NewFileRunStore(path, watermarksPath string) *FileRunStore {
+	return &FileRunStore{
+		path:           path,
+		watermarksPath: watermarksPath,
+	}
+}
+
+func (f *FileRunStore) PutRun(run RunRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("unable to marshal run %s: %v", run.RunID, err)
+	}
+	line = append(line, '\n')
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open run store %s: %v", f.path, err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(line)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write to run store %s: %v", f.path, err)
+	}
+
+	return nil
+}
+
+// readRuns returns the latest entry of every run in the log. A torn trailing line is ignored
+func (f *FileRunStore) readRuns() (map[string]RunRecord, error) {
+	runs := map[string]RunRecord{}
+
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return runs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open run store %s: %v", f.path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err2 := reader.ReadBytes('\n')
+		if err2 == io.EOF {
+			break
+		}
+		if err2 != nil {
+			return nil, fmt.Errorf("unable to read run store %s: %v", f.path, err2)
+		}
+
+		var run RunRecord
+		err2 = json.Unmarshal(bytes.TrimSpace(line), &run)
+		if err2 != nil {
+			return nil, fmt.Errorf("unable to unmarshal run store entry in %s: %v", f.path, err2)
+		}
+		runs[run.RunID] = run
+	}
+
+	return runs, nil
+}
+
+func (f *FileRunStore) GetRun(runID string) (*RunRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	runs, err := f.readRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	run, found := runs[runID]
+	if !found {
+		return nil, nil
+	}
+	return &run, nil
+}
+
+func (f *FileRunStore) ListRuns(limit int) ([]*RunRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	runs, err := f.readRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*RunRecord
+	for _, run := range runs {
+		run := run
+		results = append(results, &run)
+	}
+
+	return sortRunsByStartTime(results, limit), nil
+}
+
+// readWatermarks returns every watermark in the watermarks file
+func (f *FileRunStore) readWatermarks() (map[string]time.Time, error) {
+	watermarks := map[string]time.Time{}
+
+	data, err := os.ReadFile(f.watermarksPath)
+	if os.IsNotExist(err) {
+		return watermarks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read watermarks %s: %v", f.watermarksPath, err)
+	}
+
+	err = json.Unmarshal(data, &watermarks)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal watermarks %s: %v", f.watermarksPath, err)
+	}
+
+	return watermarks, nil
+}
+
+func (f *FileRunStore) GetWatermark(collection, region string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	watermarks, err := f.readWatermarks()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return watermarks[watermarkID(collection, region)], nil
+}
+
+func (f *FileRunStore) PutWatermark(collection, region string, date time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	watermarks, err := f.readWatermarks()
+	if err != nil {
+		return err
+	}
+	watermarks[watermarkID(collection, region)] = date
+
+	data, err := json.MarshalIndent(watermarks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal watermarks: %v", err)
+	}
+
+	return writeFileAtomic(f.watermarksPath, data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %v", tmpPath, err)
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %v", tmpPath, err)
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("unable to replace %s: %v", path, err)
+	}
+	syncDir(filepath.Dir(path))
+
+	return nil
+}
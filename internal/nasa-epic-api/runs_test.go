@@ -0,0 +1,83 @@
+package nasa_epic_api
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testRunStores returns an empty run store of each backend which runs without AWS
+func testRunStores(t *testing.T) map[string]RunStore {
+	dir := t.TempDir()
+	return map[string]RunStore{
+		"memory": NewMemoryRunStore(),
+		"file":   NewFileRunStore(filepath.Join(dir, "runs.jsonl"), filepath.Join(dir, "watermarks.json")),
+	}
+}
+
+func TestListRuns(t *testing.T) {
+	start := time.Date(2023, 1, 1, 2, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{0, []string{"c", "b", "a"}},
+		{2, []string{"c", "b"}},
+		{5, []string{"c", "b", "a"}},
+	}
+
+	for name, store := range testRunStores(t) {
+		for _, run := range []RunRecord{
+			{RunID: "b", StartTime: start.AddDate(0, 0, 1)},
+			{RunID: "a", StartTime: start},
+			{RunID: "c", StartTime: start.AddDate(0, 0, 2)},
+		} {
+			err := store.PutRun(run)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the last write of a run wins
+		err := store.PutRun(RunRecord{RunID: "a", StartTime: start, Uploaded: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range tests {
+			runs, err := store.ListRuns(test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, run := range runs {
+				got = append(got, run.RunID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: ListRuns(%d) = %v, want %v", name, test.limit, got, test.want)
+			}
+		}
+
+		run, err := store.GetRun("a")
+		if err != nil || run == nil || run.Uploaded != 3 {
+			t.Errorf("%s: expected the last write of run a, got %+v, %v", name, run, err)
+		}
+		if run, _ = store.GetRun("missing"); run != nil {
+			t.Errorf("%s: expected no run for an unknown RunID, got %+v", name, run)
+		}
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	start := time.Date(2023, 1, 1, 2, 0, 0, 0, time.UTC)
+	run := RunRecord{StartTime: start, EndTime: start.Add(90 * time.Second)}
+	if got := run.Duration(); got != 90*time.Second {
+		t.Errorf("Duration() = %v, want 1m30s", got)
+	}
+
+	running := NewRunRecord("running")
+	if got := running.Duration(); got < 0 || got > time.Minute {
+		t.Errorf("expected the duration of an unfinished run to be measured to now, got %v", got)
+	}
+}
@@ -2,35 +2,45 @@ package nasa_epic_api
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
-	"io/ioutil"
-	"os"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-func CreateS3Client() (*s3.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// CreateS3Client returns an *s3.Client connected as configured by clientConfig
+func CreateS3Client(clientConfig AWSClientConfig) (*s3.Client, error) {
+	cfg, err := loadAWSConfig(clientConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	client := s3.NewFromConfig(cfg)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if clientConfig.EndpointURL != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(clientConfig.EndpointURL)
+		}
+		o.UsePathStyle = clientConfig.UsePathStyle
+	})
 
 	return client, nil
 }
 
-func UploadS3Object(client *s3.Client, sourceFile io.Reader, targetBucket, targetKey, contentType string) (string, error) {
+func UploadS3Object(client *s3.Client, sourceFile io.Reader, targetBucket, targetKey, contentType, cacheControl string) (string, error) {
 	uploadOptions := &s3.PutObjectInput{
-		Bucket:      aws.String(targetBucket),
-		Key:         aws.String(targetKey),
-		ContentType: aws.String(contentType),
-		Body:        sourceFile,
+		Bucket:       aws.String(targetBucket),
+		Key:          aws.String(targetKey),
+		ContentType:  aws.String(contentType),
+		CacheControl: aws.String(cacheControl),
+		Body:         sourceFile,
 	}
 
 	uploader := manager.NewUploader(client)
@@ -45,60 +55,132 @@ func UploadS3Object(client *s3.Client, sourceFile io.Reader, targetBucket, targe
 	return result.Location, nil
 }
 
-func GenerateHTMLIndex(recordings []*NasaEpicRecording, s3client *s3.Client, bucketName string) error {
-	sourceIndexFile := "/tmp/index.html"
-	DestinationIndexFile := "index.html"
-	favIcon := "favicon.png"
-	favIconPath := "images/" + favIcon
-	sourceTemplateFile := "internal/nasa-epic-api/templates/index.tmpl"
+// PresignS3Object returns a URL which allows anyone holding it to get the object at targetKey until expiry has passed
+func PresignS3Object(client *s3.Client, targetBucket, targetKey string, expiry time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(client, s3.WithPresignExpires(expiry))
 
-	sourceFile, err := ioutil.ReadFile(sourceTemplateFile)
+	request, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(targetBucket),
+		Key:    aws.String(targetKey),
+	})
 	if err != nil {
-		return fmt.Errorf("unable to open source template file %s: %v", sourceTemplateFile, err)
+		return "", err
 	}
 
-	index := template.Must(template.New("index").Parse(string(sourceFile)))
+	return request.URL, nil
+}
 
-	// upload favicon to S3
-	file, err2 := os.Open(favIconPath)
-	if err2 != nil {
-		return fmt.Errorf("unable to open favIcon file %s: %v", favIcon, err2)
+// DeleteS3Object deletes the object at targetKey. Deleting a missing object is not an error
+func DeleteS3Object(client *s3.Client, targetBucket, targetKey string) error {
+	deleteOptions := &s3.DeleteObjectInput{
+		Bucket: aws.String(targetBucket),
+		Key:    aws.String(targetKey),
 	}
-	defer file.Close()
 
-	s3FavLocation, err3 := UploadS3Object(s3client, file, bucketName, favIcon, "image/png")
-	if err3 != nil {
-		return fmt.Errorf("unable to upload favicon to S3: %v", err3)
+	_, err := client.DeleteObject(context.TODO(), deleteOptions)
+	if err != nil {
+		return err
 	}
 
-	recordingDetails := recordingDetail{
-		recordings,
-		s3FavLocation,
-		"",
+	fmt.Printf("deleted object %s from S3 bucket %s\n", targetKey, targetBucket)
+
+	return nil
+}
+
+// GetS3Object returns the body of the object at targetKey, which the caller must close
+func GetS3Object(client *s3.Client, targetBucket, targetKey string) (io.ReadCloser, error) {
+	result, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(targetBucket),
+		Key:    aws.String(targetKey),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	file2, err4 := os.Create(sourceIndexFile)
-	if err4 != nil {
-		return fmt.Errorf("unable to create HTML index file: %v", err4)
+	return result.Body, nil
+}
+
+// CheckIfS3ObjectExists reports whether an object exists at targetKey
+func CheckIfS3ObjectExists(client *s3.Client, targetBucket, targetKey string) (bool, error) {
+	_, err := client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(targetBucket),
+		Key:    aws.String(targetKey),
+	})
+
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetS3ObjectCacheControl replaces the Cache-Control header of the object at targetKey by copying the object onto
+// itself, keeping its content type and metadata. It reports whether the header was changed
+func SetS3ObjectCacheControl(client *s3.Client, targetBucket, targetKey, cacheControl string) (bool, error) {
+	head, err := client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(targetBucket),
+		Key:    aws.String(targetKey),
+	})
+	if err != nil {
+		return false, err
+	}
+	if aws.ToString(head.CacheControl) == cacheControl {
+		return false, nil
 	}
-	defer file2.Close()
 
-	err = index.Execute(file2, recordingDetails)
+	_, err = client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:            aws.String(targetBucket),
+		Key:               aws.String(targetKey),
+		CopySource:        aws.String(s3CopySource(targetBucket, targetKey)),
+		MetadataDirective: types.MetadataDirectiveReplace,
+		ContentType:       head.ContentType,
+		Metadata:          head.Metadata,
+		CacheControl:      aws.String(cacheControl),
+	})
 	if err != nil {
-		return fmt.Errorf("unable to execute the templating action: %v", err)
+		return false, err
 	}
 
-	file3, err5 := os.Open(sourceIndexFile)
-	if err5 != nil {
-		return fmt.Errorf("unable to open file %s: %v", sourceIndexFile, err5)
+	fmt.Printf("set Cache-Control of object %s in S3 bucket %s to %s\n", targetKey, targetBucket, cacheControl)
+
+	return true, nil
+}
+
+// s3CopySource returns the URL-encoded bucket and key of an object to copy. Each segment of the key is escaped on its
+// own, as the slashes separating the bucket and key segments must be kept
+func s3CopySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
 	}
-	defer file3.Close()
+	return bucket + "/" + strings.Join(segments, "/")
+}
 
-	// upload to S3 to serve as static hosted website index file
-	_, err6 := UploadS3Object(s3client, file3, bucketName, DestinationIndexFile, "text/html")
-	if err6 != nil {
-		return fmt.Errorf("unable to upload index file to S3: %v", err6)
+// ListS3Objects returns every object in the bucket whose key starts with prefix
+func ListS3Objects(client *s3.Client, targetBucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(targetBucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:  aws.ToString(object.Key),
+				Size: object.Size,
+				ETag: strings.Trim(aws.ToString(object.ETag), "\""),
+			})
+		}
 	}
 
-	return nil
+	return objects, nil
 }
@@ -0,0 +1,21 @@
+package nasa_epic_api
+
+import "testing"
+
+func TestS3CopySource(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"index.html", "bucket/index.html"},
+		{"2023-01-01/epic_1b_20230101003633.png", "bucket/2023-01-01/epic_1b_20230101003633.png"},
+		{"theme/templates/index page.tmpl", "bucket/theme/templates/index%20page.tmpl"},
+		{"feeds/region-a?b#c.atom.xml", "bucket/feeds/region-a%3Fb%23c.atom.xml"},
+	}
+
+	for _, test := range tests {
+		if got := s3CopySource("bucket", test.key); got != test.want {
+			t.Errorf("s3CopySource(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
@@ -5,22 +5,25 @@ import (
 	"context"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 )
 
-// CreateSESClient returns an *sesv2.Client
-func CreateSESClient(region string) (*sesv2.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+// CreateSESClient returns an *sesv2.Client connected as configured by clientConfig
+func CreateSESClient(clientConfig AWSClientConfig) (*sesv2.Client, error) {
+	cfg, err := loadAWSConfig(clientConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	client := sesv2.NewFromConfig(cfg)
+	client := sesv2.NewFromConfig(cfg, func(o *sesv2.Options) {
+		if clientConfig.EndpointURL != "" {
+			o.EndpointResolver = sesv2.EndpointResolverFromURL(clientConfig.EndpointURL)
+		}
+	})
 
 	return client, nil
 }
@@ -64,20 +67,21 @@ func SendEmail(client *sesv2.Client, sender string, recipients []string, subject
 	return aws.ToString(output.MessageId), nil
 }
 
-// SendEmailReport generates an HTML report based on []*NasaEpicRecording and then calls SendEmail
-func SendEmailReport(recordings []*NasaEpicRecording, client *sesv2.Client, sender string, recipients []string, websiteURL string) error {
-	sourceTemplateFile := "internal/nasa-epic-api/templates/emailReport.tmpl"
+// SendEmailReport generates an HTML report based on []*NasaEpicRecording from the theme's emailReport template,
+// or the default theme's if theme is nil, and then calls SendEmail. Pages and images are linked beneath websiteURL,
+// with the images of a private bucket linked by their presigned URLs instead
+func SendEmailReport(recordings []*NasaEpicRecording, client *sesv2.Client, sender string, recipients []string, websiteURL string, theme *Theme, objects ObjectStore) error {
+	if theme == nil {
+		theme = DefaultTheme()
+	}
 
-	sourceFile, err := ioutil.ReadFile(sourceTemplateFile)
+	index, err := theme.Template("emailReport", emailFuncs(websiteURL, objects))
 	if err != nil {
-		return fmt.Errorf("unable to open source template file %s: %v", sourceTemplateFile, err)
+		return err
 	}
 
-	index := template.Must(template.New("emailReport").Parse(string(sourceFile)))
-
 	recordingDetails := recordingDetail{
 		recordings,
-		"",
 		websiteURL,
 	}
 
@@ -92,7 +96,19 @@ func SendEmailReport(recordings []*NasaEpicRecording, client *sesv2.Client, send
 	bodyText := fmt.Sprintf("%+v", recordings)
 	bodyHTML := report.String()
 
-	messageID, err := SendEmail(client, sender, recipients, "Nasa Epic Coordinate Matches", bodyText, bodyHTML)
+	// significant changes are called out in the subject so that they are noticed without opening the report
+	subject := "Nasa Epic Coordinate Matches"
+	flagged := 0
+	for _, recording := range recordings {
+		if recording.Change != nil && recording.Change.Flagged {
+			flagged++
+		}
+	}
+	if flagged > 0 {
+		subject = fmt.Sprintf("%s (%d significant changes)", subject, flagged)
+	}
+
+	messageID, err := SendEmail(client, sender, recipients, subject, bodyText, bodyHTML)
 	if err != nil {
 		return fmt.Errorf("problems sending email: %v", err)
 	}
@@ -100,3 +116,29 @@ func SendEmailReport(recordings []*NasaEpicRecording, client *sesv2.Client, send
 
 	return nil
 }
+
+// emailFuncs returns the functions available to the email report template. Rows link to the recording pages and
+// diff images of the website. Images of a private bucket are linked by presigned URLs, as the email is read outside
+// of the gateway, while pages are still linked through the gateway as their own links are relative
+func emailFuncs(websiteURL string, objects ObjectStore) template.FuncMap {
+	pageURL := func(key string) string {
+		return strings.TrimSuffix(websiteURL, "/") + "/" + key
+	}
+
+	return template.FuncMap{
+		"pageURL": func(r *NasaEpicRecording) string {
+			return pageURL(r.PageKey())
+		},
+		"objectURL": func(key string) string {
+			if objects == nil || !objects.Private() {
+				return pageURL(key)
+			}
+			location, err := objects.PresignedURL(key)
+			if err != nil {
+				fmt.Printf("unable to presign object %s: %v\n", key, err)
+				return pageURL(key)
+			}
+			return location
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	localSolarTimeFormat = "15:04"
+)
+
+// NewSolarTimeWindow parses two "15:04" formatted strings into a *SolarTimeWindow.
+// A nil window is returned if both values are empty, which disables the filter
+func NewSolarTimeWindow(min, max string) (*SolarTimeWindow, error) {
+	if min == "" && max == "" {
+		return nil, nil
+	}
+
+	if min == "" || max == "" {
+		return nil, fmt.Errorf("both a min and max local solar time must be set")
+	}
+
+	minTime, err := time.Parse(localSolarTimeFormat, min)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse min local solar time %s: %v", min, err)
+	}
+
+	maxTime, err2 := time.Parse(localSolarTimeFormat, max)
+	if err2 != nil {
+		return nil, fmt.Errorf("unable to parse max local solar time %s: %v", max, err2)
+	}
+
+	return &SolarTimeWindow{
+		Min: timeOfDay(minTime),
+		Max: timeOfDay(maxTime),
+	}, nil
+}
+
+// Contains reports whether the time of day of t falls within the window. Windows where Min is after Max wrap midnight
+func (w *SolarTimeWindow) Contains(t time.Time) bool {
+	tod := timeOfDay(t)
+	if w.Min <= w.Max {
+		return tod >= w.Min && tod <= w.Max
+	}
+	return tod >= w.Min || tod <= w.Max
+}
+
+// LocalSolarTime returns the apparent local solar time at longitude for the UTC instant date
+func LocalSolarTime(date time.Time, longitude float64) time.Time {
+	// 4 minutes per degree of longitude, plus the equation of time correction
+	offsetMinutes := longitude*4 + equationOfTime(date)
+	return date.UTC().Add(time.Duration(offsetMinutes * float64(time.Minute)))
+}
+
+// SetLocalSolarTime sets the LocalSolarTime field of all recordings based on their Date and longitude
+func SetLocalSolarTime(slice []*NasaEpicRecording, longitude float64) {
+	for i := 0; i < len(slice); i++ {
+		slice[i].LocalSolarTime = LocalSolarTime(slice[i].Date, longitude).Format(localSolarTimeFormat)
+	}
+}
+
+// QueryRecordingsOnLocalSolarTime returns the recordings whose local solar time at longitude falls within window
+func QueryRecordingsOnLocalSolarTime(slice []*NasaEpicRecording, longitude float64, window *SolarTimeWindow) []*NasaEpicRecording {
+	if window == nil {
+		return slice
+	}
+
+	var resultsSlice []*NasaEpicRecording
+	for i := 0; i < len(slice); i++ {
+		if window.Contains(LocalSolarTime(slice[i].Date, longitude)) {
+			resultsSlice = append(resultsSlice, slice[i])
+		}
+	}
+	fmt.Printf("number of local solar time matches: %d\n", len(resultsSlice))
+
+	return resultsSlice
+}
+
+// RegionCentreLongitude returns the longitude at the centre of the target coordinates range
+func RegionCentreLongitude(coordinates map[string]float64) float64 {
+	return (coordinates["lonMin"] + coordinates["lonMax"]) / 2
+}
+
+// equationOfTime returns the difference in minutes between apparent and mean solar time for the day of date
+func equationOfTime(date time.Time) float64 {
+	b := 2 * math.Pi * float64(date.UTC().YearDay()-81) / 365
+	return 9.87*math.Sin(2*b) - 7.53*math.Cos(b) - 1.5*math.Sin(b)
+}
+
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
@@ -0,0 +1,85 @@
+package nasa_epic_api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSolarTimeWindow(t *testing.T) {
+	tests := []struct {
+		min, max string
+		want     *SolarTimeWindow
+		wantErr  bool
+	}{
+		{"", "", nil, false},
+		{"09:00", "15:00", &SolarTimeWindow{Min: 9 * time.Hour, Max: 15 * time.Hour}, false},
+		{"22:30", "02:00", &SolarTimeWindow{Min: 22*time.Hour + 30*time.Minute, Max: 2 * time.Hour}, false},
+		{"09:00", "", nil, true},
+		{"9am", "15:00", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := NewSolarTimeWindow(test.min, test.max)
+		if (err != nil) != test.wantErr {
+			t.Errorf("NewSolarTimeWindow(%q, %q) error = %v, want error %t", test.min, test.max, err, test.wantErr)
+			continue
+		}
+		if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Errorf("NewSolarTimeWindow(%q, %q) = %+v, want %+v", test.min, test.max, got, test.want)
+		}
+	}
+}
+
+func TestSolarTimeWindowContains(t *testing.T) {
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := &SolarTimeWindow{Min: 9 * time.Hour, Max: 15 * time.Hour}
+	overnight := &SolarTimeWindow{Min: 22 * time.Hour, Max: 2 * time.Hour}
+
+	tests := []struct {
+		window *SolarTimeWindow
+		at     time.Duration
+		want   bool
+	}{
+		{window, 8*time.Hour + 59*time.Minute, false},
+		{window, 9 * time.Hour, true},
+		{window, 12 * time.Hour, true},
+		{window, 15 * time.Hour, true},
+		{window, 15*time.Hour + time.Minute, false},
+		{overnight, 23 * time.Hour, true},
+		{overnight, time.Hour, true},
+		{overnight, 12 * time.Hour, false},
+	}
+
+	for _, test := range tests {
+		if got := test.window.Contains(day.Add(test.at)); got != test.want {
+			t.Errorf("%+v.Contains(%v) = %t, want %t", test.window, test.at, got, test.want)
+		}
+	}
+}
+
+func TestQueryRecordingsOnLocalSolarTime(t *testing.T) {
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := &SolarTimeWindow{Min: 9 * time.Hour, Max: 15 * time.Hour}
+
+	// at 25 degrees east local solar time is around 1h36m ahead of UTC in early January
+	recordings := []*NasaEpicRecording{
+		{Identifier: "dawn", Date: day.Add(6 * time.Hour)},
+		{Identifier: "morning", Date: day.Add(8 * time.Hour)},
+		{Identifier: "noon", Date: day.Add(10*time.Hour + 24*time.Minute)},
+		{Identifier: "evening", Date: day.Add(14 * time.Hour)},
+	}
+
+	matches := QueryRecordingsOnLocalSolarTime(recordings, 25, window)
+
+	var got []string
+	for _, recording := range matches {
+		got = append(got, recording.Identifier)
+	}
+	if len(got) != 2 || got[0] != "morning" || got[1] != "noon" {
+		t.Errorf("expected the morning and noon recordings, got %v", got)
+	}
+
+	if all := QueryRecordingsOnLocalSolarTime(recordings, 25, nil); len(all) != len(recordings) {
+		t.Errorf("expected a nil window to match every recording, got %d", len(all))
+	}
+}
@@ -0,0 +1,297 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordingStore persists the DBRecord of every processed recording
+type RecordingStore interface {
+	// Exists reports whether a completed record is present for the key. In-progress claims are reported as
+	// not present, leaving Claim to decide whether they can be taken over
+	Exists(key RecordKey) (bool, error)
+	// ExistsBatch reports which of keys have a record present, as per Exists
+	ExistsBatch(keys []RecordKey) (map[RecordKey]bool, error)
+	// Claim marks the recording as in progress by owner until leaseExpiry. It returns false if the
+	// recording is already completed or claimed under an unexpired lease
+	Claim(key RecordKey, owner string, leaseExpiry time.Time) (bool, error)
+	// Complete writes the record as completed, only if the recording is still claimed by owner. It returns false
+	// if the claim has since been taken over by another run, which is then left to complete the recording
+	Complete(record DBRecord, owner string) (bool, error)
+	// Put writes the record, replacing any existing record with the same key
+	Put(record DBRecord) error
+	// PutBatch writes all records unconditionally, replacing any existing records with the same keys. It is used for
+	// bulk loads such as imports: processed recordings are written one at a time by Complete, as a batched write
+	// cannot be conditional on each recording's claim
+	PutBatch(records []DBRecord) error
+	// Delete removes the record for the key. Deleting a missing record is not an error
+	Delete(key RecordKey) error
+	// Get returns the record for the key, or nil if not found
+	Get(key RecordKey) (*DBRecord, error)
+	// List returns all records matching filter, sorted by date
+	List(filter RecordingFilter) ([]*DBRecord, error)
+	// Each calls fn with every record matching filter as it is read, without holding them all in memory. Records
+	// are only sorted by date where the store keeps them in that order. Iteration stops at the first error from fn
+	Each(filter RecordingFilter, fn func(record *DBRecord) error) error
+	// QueryByDateRange returns the records dated between from and to inclusive, sorted by date
+	QueryByDateRange(from, to time.Time) ([]*DBRecord, error)
+}
+
+// RecordKey is the primary key of a DBRecord. RecordID is the collection and identifier joined with a '#' and
+// Timestamp is the RFC3339 UTC recording time, so records of the same recording sort chronologically
+type RecordKey struct {
+	RecordID  string
+	Timestamp string
+}
+
+// NewRecordKey returns the RecordKey of a recording
+func NewRecordKey(collection, identifier string, date time.Time) RecordKey {
+	if collection == "" {
+		collection = defaultCollection
+	}
+	return RecordKey{
+		RecordID:  collection + "#" + identifier,
+		Timestamp: date.UTC().Format(time.RFC3339),
+	}
+}
+
+// Identifier returns the EPIC identifier part of the RecordID
+func (k RecordKey) Identifier() string {
+	_, identifier := splitRecordID(k.RecordID)
+	return identifier
+}
+
+// Key returns the primary key of the record. Records written before the RecordID/Timestamp key scheme have
+// their key derived from the collection, identifier and date
+func (r *DBRecord) Key() RecordKey {
+	if r.RecordID != "" && r.Timestamp != "" {
+		return RecordKey{RecordID: r.RecordID, Timestamp: r.Timestamp}
+	}
+	return NewRecordKey(r.Collection, r.Identifier, r.Date)
+}
+
+// splitRecordID splits a RecordID into its collection and identifier
+func splitRecordID(recordID string) (string, string) {
+	parts := strings.SplitN(recordID, "#", 2)
+	if len(parts) != 2 {
+		return "", recordID
+	}
+	return parts[0], parts[1]
+}
+
+// RecordingFilter restricts the records returned by RecordingStore.List. Zero values match all completed records
+type RecordingFilter struct {
+	From time.Time
+	To   time.Time
+	// Region is the name of a watch region
+	Region string
+
+	IncludeInProgress bool
+}
+
+// Matches reports whether the record passes the filter
+func (f RecordingFilter) Matches(record *DBRecord) bool {
+	if !f.IncludeInProgress && !record.IsCompleted() {
+		return false
+	}
+	if !f.From.IsZero() && record.Date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && record.Date.After(f.To) {
+		return false
+	}
+	if f.Region != "" && record.Region != f.Region {
+		return false
+	}
+	return true
+}
+
+// RecordingStoreConfig selects and configures a RecordingStore backend
+type RecordingStoreConfig struct {
+	Backend   string
+	TableName string
+	FilePath  string
+
+	// AWS configures the DynamoDB client
+	AWS AWSClientConfig
+
+	// ScanSegments is the number of parallel segments used when scanning a DynamoDB table
+	ScanSegments int
+
+	// RunsTableName is the DynamoDB table holding the run history, see NewRunStore
+	RunsTableName string
+}
+
+// NewRecordingStore returns the RecordingStore for the configured backend
+func NewRecordingStore(cfg RecordingStoreConfig) (RecordingStore, error) {
+	switch cfg.Backend {
+	case "", "dynamodb":
+		client, err := CreateDBClient(cfg.AWS)
+		if err != nil {
+			return nil, err
+		}
+		return NewDynamoDBRecordingStore(client, cfg.TableName, cfg.ScanSegments), nil
+	case "file":
+		if cfg.FilePath == "" {
+			return nil, fmt.Errorf("a file path must be set for the file recording store")
+		}
+		return OpenFileRecordingStore(cfg.FilePath)
+	case "memory":
+		return NewMemoryRecordingStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown recording store backend: %s", cfg.Backend)
+	}
+}
+
+// SortRecordsByDate sorts records in place based on date/time
+func SortRecordsByDate(records []*DBRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Date.Before(records[j].Date)
+	})
+}
+
+// MemoryRecordingStore is a RecordingStore held in memory. Records are lost when the process exits
+type MemoryRecordingStore struct {
+	mu      sync.RWMutex
+	records map[string]DBRecord
+}
+
+func NewMemoryRecordingStore() *MemoryRecordingStore {
+	return &MemoryRecordingStore{
+		records: map[string]DBRecord{},
+	}
+}
+
+func (m *MemoryRecordingStore) Exists(key RecordKey) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, found := m.records[recordKey(key)]
+	return found && record.IsCompleted(), nil
+}
+
+func (m *MemoryRecordingStore) ExistsBatch(keys []RecordKey) (map[RecordKey]bool, error) {
+	return existsEach(m, keys)
+}
+
+func (m *MemoryRecordingStore) Claim(key RecordKey, owner string, leaseExpiry time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := recordKey(key)
+	if existing, found := m.records[k]; found && !existing.IsClaimable(time.Now()) {
+		return false, nil
+	}
+	m.records[k] = newClaimRecord(key, owner, leaseExpiry)
+	return true, nil
+}
+
+func (m *MemoryRecordingStore) Complete(record DBRecord, owner string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := recordKey(record.Key())
+	if existing, found := m.records[k]; !found || !existing.isClaimedBy(owner) {
+		return false, nil
+	}
+	m.records[k] = completedRecord(record, owner)
+	return true, nil
+}
+
+func (m *MemoryRecordingStore) Put(record DBRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[recordKey(record.Key())] = record
+	return nil
+}
+
+func (m *MemoryRecordingStore) PutBatch(records []DBRecord) error {
+	return putEach(m, records)
+}
+
+func (m *MemoryRecordingStore) Delete(key RecordKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, recordKey(key))
+	return nil
+}
+
+func (m *MemoryRecordingStore) Get(key RecordKey) (*DBRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, found := m.records[recordKey(key)]
+	if !found {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (m *MemoryRecordingStore) List(filter RecordingFilter) ([]*DBRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var results []*DBRecord
+	for _, record := range m.records {
+		record := record
+		if filter.Matches(&record) {
+			results = append(results, &record)
+		}
+	}
+	SortRecordsByDate(results)
+
+	return results, nil
+}
+
+// Each passes a snapshot of the matching records to fn, so that fn may write to the store
+func (m *MemoryRecordingStore) Each(filter RecordingFilter, fn func(record *DBRecord) error) error {
+	records, err := m.List(filter)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRecordingStore) QueryByDateRange(from, to time.Time) ([]*DBRecord, error) {
+	return m.List(RecordingFilter{From: from, To: to})
+}
+
+// existsEach implements ExistsBatch for stores without a native batch lookup
+func existsEach(store RecordingStore, keys []RecordKey) (map[RecordKey]bool, error) {
+	found := map[RecordKey]bool{}
+	for _, key := range keys {
+		exists, err := store.Exists(key)
+		if err != nil {
+			return nil, err
+		}
+		found[key] = exists
+	}
+	return found, nil
+}
+
+// putEach implements PutBatch for stores without a native batch write
+func putEach(store RecordingStore, records []DBRecord) error {
+	for _, record := range records {
+		err := store.Put(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordKey joins the RecordID and Timestamp into a single map key
+func recordKey(key RecordKey) string {
+	return key.RecordID + "|" + key.Timestamp
+}
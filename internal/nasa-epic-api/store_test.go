@@ -0,0 +1,77 @@
+package nasa_epic_api
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStores returns an empty store of each backend which runs without AWS
+func testStores(t *testing.T) map[string]RecordingStore {
+	file, err := OpenFileRecordingStore(filepath.Join(t.TempDir(), "records.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	return map[string]RecordingStore{"memory": NewMemoryRecordingStore(), "file": file}
+}
+
+func TestExistsBatch(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	completed := testRecord("completed", date)
+	claimed := NewRecordKey(defaultCollection, "claimed", date.Add(time.Hour))
+	missing := NewRecordKey(defaultCollection, "missing", date.Add(2*time.Hour))
+
+	for name, store := range testStores(t) {
+		err := store.PutBatch([]DBRecord{completed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = store.Claim(claimed, "run-1", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := store.ExistsBatch([]RecordKey{completed.Key(), claimed, missing})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[RecordKey]bool{completed.Key(): true, claimed: false, missing: false}
+		for key, exists := range want {
+			if found[key] != exists {
+				t.Errorf("%s: ExistsBatch reported %s as %t, want %t", name, key.RecordID, found[key], exists)
+			}
+		}
+	}
+}
+
+func TestProcessRecordingsSkipsExistingAndClaimedRecordings(t *testing.T) {
+	date := time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC)
+	recordings := []*NasaEpicRecording{
+		{Identifier: "existing", Collection: defaultCollection, Date: date},
+		{Identifier: "claimed", Collection: defaultCollection, Date: date.Add(time.Hour)},
+	}
+
+	store := NewMemoryRecordingStore()
+	store.Put(testRecord("existing", date))
+	store.Claim(NewRecordKey(defaultCollection, "claimed", date.Add(time.Hour)), "run-1", time.Now().Add(time.Hour))
+
+	run := NewRunRecord("run-2")
+	processed, pending, err := ProcessRecordings(store, NewFileObjectStore(t.TempDir(), ""), recordings,
+		&Date{Date: date}, ClaimOptions{Owner: "run-2", Lease: time.Minute}, nil, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(processed) != 0 {
+		t.Errorf("expected nothing to be processed, got %d recordings", len(processed))
+	}
+	if pending != 1 {
+		t.Errorf("expected the recording claimed by another run to be pending, got %d", pending)
+	}
+	if run.Skipped != 2 || run.Uploaded != 0 {
+		t.Errorf("expected 2 skipped and 0 uploaded, got %d and %d", run.Skipped, run.Uploaded)
+	}
+}
@@ -0,0 +1,179 @@
+package nasa_epic_api
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	themeTemplateDir = "templates/"
+	themeAssetDir    = "assets/"
+	favIconAsset     = themeAssetDir + "favicon.png"
+)
+
+// defaultThemeFiles are the templates and assets compiled into the binary, used for any file a theme does not override
+//
+//go:embed templates/*.tmpl assets/favicon.png
+var defaultThemeFiles embed.FS
+
+// themeTemplateFuncs are the functions available to each template, which a theme's templates are validated against
+var themeTemplateFuncs = map[string]template.FuncMap{
+	"index":       pageFuncs(nil),
+	"month":       pageFuncs(nil),
+	"recording":   pageFuncs(nil),
+	"emailReport": emailFuncs("", nil),
+}
+
+// ThemeConfig locates the files overriding the default theme. Files are named as in the default theme, e.g.
+// templates/index.tmpl or assets/favicon.png, relative to the directory or prefix
+type ThemeConfig struct {
+	// Directory is a local directory of override files
+	Directory string
+	// Prefix is a key prefix of override files in the object store, e.g. theme/
+	Prefix string
+}
+
+// Theme holds the templates and assets of the generated pages and email report
+type Theme struct {
+	files map[string][]byte
+}
+
+// DefaultTheme returns the theme compiled into the binary
+func DefaultTheme() *Theme {
+	theme := &Theme{files: map[string][]byte{}}
+	err := fs.WalkDir(defaultThemeFiles, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		theme.files[name], err = defaultThemeFiles.ReadFile(name)
+		return err
+	})
+	if err != nil {
+		// the embedded files are fixed at build time
+		panic(fmt.Errorf("unable to read the default theme: %v", err))
+	}
+	return theme
+}
+
+// LoadTheme returns the default theme with any files found in the configured directory, and then under the
+// configured prefix of objects, in place of the defaults. The theme is validated so that a broken override is
+// reported at startup rather than when the pages are next generated
+func LoadTheme(cfg ThemeConfig, objects ObjectStore) (*Theme, error) {
+	theme := DefaultTheme()
+
+	if cfg.Directory != "" {
+		err := filepath.Walk(cfg.Directory, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+				return err
+			}
+			relative, err := filepath.Rel(cfg.Directory, filePath)
+			if err != nil {
+				return err
+			}
+			body, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			return theme.override(filepath.ToSlash(relative), body)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to load theme directory %s: %v", cfg.Directory, err)
+		}
+	}
+
+	if cfg.Prefix != "" {
+		listed, err := objects.List(cfg.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list theme objects under %s: %v", cfg.Prefix, err)
+		}
+		for _, object := range listed {
+			body, err2 := readObject(objects, object.Key)
+			if err2 != nil {
+				return nil, fmt.Errorf("unable to read theme object %s: %v", object.Key, err2)
+			}
+			err2 = theme.override(strings.TrimPrefix(object.Key, cfg.Prefix), body)
+			if err2 != nil {
+				return nil, fmt.Errorf("unable to load theme prefix %s: %v", cfg.Prefix, err2)
+			}
+		}
+	}
+
+	err := theme.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return theme, nil
+}
+
+// override replaces a default file. Only files of the default theme can be overridden, so that a misnamed file is
+// reported rather than silently ignored
+func (t *Theme) override(name string, body []byte) error {
+	if _, found := t.files[name]; !found {
+		return fmt.Errorf("unknown theme file %s, expected one of: %s", name, strings.Join(t.names(), ", "))
+	}
+	t.files[name] = body
+	fmt.Printf("using theme override %s\n", name)
+	return nil
+}
+
+// Validate parses every template with the functions it is executed with
+func (t *Theme) Validate() error {
+	for name, funcs := range themeTemplateFuncs {
+		_, err := t.Template(name, funcs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Template parses the named template
+func (t *Theme) Template(name string, funcs template.FuncMap) (*template.Template, error) {
+	fileName := themeTemplateDir + name + ".tmpl"
+	source, found := t.files[fileName]
+	if !found {
+		return nil, fmt.Errorf("theme has no template %s", fileName)
+	}
+
+	parsed, err := template.New(name).Funcs(funcs).Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse theme template %s: %v", fileName, err)
+	}
+	return parsed, nil
+}
+
+// Asset returns the named asset, e.g. assets/favicon.png
+func (t *Theme) Asset(name string) ([]byte, error) {
+	body, found := t.files[name]
+	if !found {
+		return nil, fmt.Errorf("theme has no asset %s", name)
+	}
+	return body, nil
+}
+
+func (t *Theme) names() []string {
+	names := make([]string, 0, len(t.files))
+	for name := range t.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readObject returns the whole body of an object
+func readObject(objects ObjectStore, key string) ([]byte, error) {
+	body, err := objects.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
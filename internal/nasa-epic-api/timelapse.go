@@ -0,0 +1,263 @@
+package nasa_epic_api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// timeLapsePrefix is the key prefix of every time-lapse
+	timeLapsePrefix = "timelapse/"
+
+	// DefaultTimeLapseWidth is the width in pixels of time-lapse frames when not configured
+	DefaultTimeLapseWidth = 480
+	// DefaultTimeLapseFrameDelay is the time each frame of a time-lapse is shown for when not configured
+	DefaultTimeLapseFrameDelay = 500 * time.Millisecond
+
+	// TimeLapsePaletteAdaptive builds a palette of the most common colours of the frames
+	TimeLapsePaletteAdaptive = "adaptive"
+	// TimeLapsePalettePlan9 uses the fixed 256 colour Plan 9 palette
+	TimeLapsePalettePlan9 = "plan9"
+	// TimeLapsePaletteWebSafe uses the fixed 216 colour web safe palette
+	TimeLapsePaletteWebSafe = "websafe"
+
+	// maxPaletteSize is the largest number of colours a GIF frame can hold
+	maxPaletteSize = 256
+)
+
+// TimeLapseOptions configures the time-lapse generated by GenerateTimeLapse
+type TimeLapseOptions struct {
+	// Region is the name of the watch region, whose recordings are the frames of the time-lapse
+	Region string
+	// Coordinates is the target coordinates range of the region, used to crop each recording
+	Coordinates map[string]float64
+	From        time.Time
+	To          time.Time
+
+	FrameDelay time.Duration
+	// Width is the width in pixels of every frame. The height follows the proportions of the region
+	Width int
+	// Palette is one of adaptive, plan9 or websafe
+	Palette string
+	// PaletteSize is the number of colours of the adaptive palette
+	PaletteSize int
+
+	// Key is the object key of the time-lapse. Defaults to TimeLapseKey
+	Key string
+}
+
+// timeLapseLink is a published time-lapse, as linked from the landing page
+type timeLapseLink struct {
+	Region string
+	Period string
+	Key    string
+}
+
+// TimeLapseKey returns the key of the time-lapse of region between from and to, e.g.
+// timelapse/baja-california/2023-01-01_2023-01-31.gif
+func TimeLapseKey(region string, from, to time.Time) string {
+	return fmt.Sprintf("%s%s/%s_%s.gif", timeLapsePrefix, slugify(region), from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"))
+}
+
+// LatestTimeLapseKey returns the key of the rolling time-lapse of region generated at the end of each run
+func LatestTimeLapseKey(region string) string {
+	return fmt.Sprintf("%s%s/latest.gif", timeLapsePrefix, slugify(region))
+}
+
+// GenerateTimeLapse crops the region from each of its recordings between opts.From and opts.To and uploads them,
+// oldest first, as an animated GIF. Recordings in which the region is not visible are skipped. It returns the key
+// of the time-lapse and its number of frames
+func GenerateTimeLapse(store RecordingStore, objects ObjectStore, opts TimeLapseOptions) (string, int, error) {
+	if opts.Key == "" {
+		opts.Key = TimeLapseKey(opts.Region, opts.From, opts.To)
+	}
+
+	records, err := store.List(RecordingFilter{From: opts.From, To: opts.To, Region: opts.Region})
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to list the recordings of region %s: %v", opts.Region, err)
+	}
+	SortRecordsByDate(records)
+
+	if opts.Width <= 0 {
+		opts.Width = DefaultTimeLapseWidth
+	}
+
+	// every recording is projected onto the same grid so that the region holds still from frame to frame
+	cropper := newRegionCropper(opts.Coordinates)
+	var frames []image.Image
+	for _, record := range records {
+		crop, err2 := cropper.LoadProjected(objects, record, opts.Width)
+		if err2 != nil {
+			fmt.Printf("skipping time-lapse frame %s: %v\n", record.Key().RecordID, err2)
+			continue
+		}
+		frames = append(frames, crop)
+	}
+	if len(frames) == 0 {
+		return "", 0, fmt.Errorf("no recordings of region %s to build a time-lapse from", opts.Region)
+	}
+
+	body, err := EncodeTimeLapse(frames, opts)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// time-lapses are rewritten in place, such as the rolling time-lapse of each run
+	_, err = objects.Put(opts.Key, bytes.NewReader(body), "image/gif", CacheControlShort)
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to upload time-lapse %s to object store: %v", opts.Key, err)
+	}
+
+	return opts.Key, len(frames), nil
+}
+
+// EncodeTimeLapse scales frames to the configured width and encodes them as a looping animated GIF. Frames should
+// share the same framing, such as the projections of GenerateTimeLapse, as each is scaled to the size of the first
+func EncodeTimeLapse(frames []image.Image, opts TimeLapseOptions) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("a time-lapse needs at least one frame")
+	}
+	if opts.Width <= 0 {
+		opts.Width = DefaultTimeLapseWidth
+	}
+	if opts.FrameDelay <= 0 {
+		opts.FrameDelay = DefaultTimeLapseFrameDelay
+	}
+
+	width, height := opts.Width, scaledHeight(frames[0], opts.Width)
+	scaled := make([]*image.RGBA, len(frames))
+	for i, frame := range frames {
+		scaled[i] = resizeImage(frame, width, height)
+	}
+
+	colours, err := timeLapsePalette(scaled, opts.Palette, opts.PaletteSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// GIF delays are in hundredths of a second
+	delay := int(opts.FrameDelay / (10 * time.Millisecond))
+	animation := &gif.GIF{Config: image.Config{ColorModel: colours, Width: width, Height: height}}
+	for _, frame := range scaled {
+		paletted := image.NewPaletted(frame.Bounds(), colours)
+		draw.FloydSteinberg.Draw(paletted, frame.Bounds(), frame, image.Point{})
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, delay)
+	}
+
+	var body bytes.Buffer
+	err = gif.EncodeAll(&body, animation)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode time-lapse: %v", err)
+	}
+
+	return body.Bytes(), nil
+}
+
+// timeLapsePalette returns the named palette. A single adaptive palette is built across every frame so that
+// colours do not flicker from one frame to the next
+func timeLapsePalette(frames []*image.RGBA, name string, size int) (color.Palette, error) {
+	switch name {
+	case "", TimeLapsePaletteAdaptive:
+		if size <= 0 || size > maxPaletteSize {
+			size = maxPaletteSize
+		}
+		return adaptivePalette(frames, size), nil
+	case TimeLapsePalettePlan9:
+		return palette.Plan9, nil
+	case TimeLapsePaletteWebSafe:
+		return palette.WebSafe, nil
+	default:
+		return nil, fmt.Errorf("unknown time-lapse palette: %s", name)
+	}
+}
+
+// adaptivePalette returns the size most common colours of frames, with each channel reduced to 5 bits so that
+// near identical colours are counted together
+func adaptivePalette(frames []*image.RGBA, size int) color.Palette {
+	type bucket struct {
+		id      uint32
+		count   int
+		r, g, b int
+	}
+	buckets := map[uint32]*bucket{}
+
+	for _, frame := range frames {
+		for i := 0; i+3 < len(frame.Pix); i += 4 {
+			r, g, b := int(frame.Pix[i]), int(frame.Pix[i+1]), int(frame.Pix[i+2])
+			id := uint32(r>>3)<<10 | uint32(g>>3)<<5 | uint32(b>>3)
+			entry, found := buckets[id]
+			if !found {
+				entry = &bucket{id: id}
+				buckets[id] = entry
+			}
+			entry.count++
+			entry.r, entry.g, entry.b = entry.r+r, entry.g+g, entry.b+b
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, entry := range buckets {
+		sorted = append(sorted, entry)
+	}
+	// ties are broken on the colour so that the same frames always give the same palette
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].id < sorted[j].id
+	})
+	if len(sorted) > size {
+		sorted = sorted[:size]
+	}
+
+	colours := make(color.Palette, 0, len(sorted))
+	for _, entry := range sorted {
+		colours = append(colours, color.RGBA{
+			R: uint8(entry.r / entry.count),
+			G: uint8(entry.g / entry.count),
+			B: uint8(entry.b / entry.count),
+			A: 0xff,
+		})
+	}
+	return colours
+}
+
+// listTimeLapses returns a link to every published time-lapse, ordered by region and then newest period first
+func listTimeLapses(objects ObjectStore) ([]timeLapseLink, error) {
+	listed, err := objects.List(timeLapsePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list objects under %s: %v", timeLapsePrefix, err)
+	}
+
+	var links []timeLapseLink
+	for _, object := range listed {
+		name := strings.TrimSuffix(strings.TrimPrefix(object.Key, timeLapsePrefix), ".gif")
+		separator := strings.Index(name, "/")
+		if separator < 0 || !strings.HasSuffix(object.Key, ".gif") {
+			continue
+		}
+		links = append(links, timeLapseLink{
+			Region: name[:separator],
+			Period: strings.Replace(name[separator+1:], "_", " to ", 1),
+			Key:    object.Key,
+		})
+	}
+
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].Region != links[j].Region {
+			return links[i].Region < links[j].Region
+		}
+		return links[i].Period > links[j].Period
+	})
+
+	return links, nil
+}
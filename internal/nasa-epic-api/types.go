@@ -10,11 +10,20 @@ type NasaEpicRecording struct {
 	Image               string
 	Version             string
 	CentroidCoordinates Coordinates `json:"centroid_coordinates"`
+	DscovrPosition      Position    `json:"dscovr_j2000_position"`
+	LunarPosition       Position    `json:"lunar_j2000_position"`
+	SunPosition         Position    `json:"sun_j2000_position"`
 	DateString          string      `json:"date"`
 	Date                time.Time
+	Collection          string
+	Region              string
 	FormattedDateStr    string
 	S3Location          string
+	S3Key               string
 	ImageSize           int64
+	ImageMD5            string
+	LocalSolarTime      string
+	Change              *ChangeResult
 }
 
 type Coordinates struct {
@@ -22,21 +31,99 @@ type Coordinates struct {
 	Lon float64
 }
 
+// Position is a J2000 position vector in kilometres
+type Position struct {
+	X float64
+	Y float64
+	Z float64
+}
+
 type Date struct {
 	DateString string `json:"date"`
 	Date       time.Time
 }
 
+// DBRecord is the persisted form of a processed recording. SchemaVersion is bumped whenever fields are added,
+// see MigrateRecords for how older records are brought up to date
 type DBRecord struct {
-	Identifier       string
+	SchemaVersion int
+
+	// RecordID (collection#identifier) and Timestamp (RFC3339 UTC) are the primary key, see RecordKey.
+	// Timestamp is also the sort key of the date range secondary index, partitioned on DatePartition (year-month)
+	RecordID      string
+	Timestamp     string
+	DatePartition string
+
+	Identifier string
+	// FormattedDateStr is the recording time for display only
 	FormattedDateStr string
 	ImageSize        int64
-	S3Location       string
-	Date             time.Time
+	// ImageMD5 is the hex MD5 hash of the uploaded image, used to verify the S3 object
+	ImageMD5       string
+	S3Location     string
+	S3Key          string
+	Date           time.Time
+	LocalSolarTime string
+	// Region is the name of the watch region the recording matched
+	Region string
+
+	Caption             string
+	Image               string
+	Version             string
+	Collection          string
+	CentroidCoordinates Coordinates
+	DscovrPosition      Position
+	LunarPosition       Position
+	SunPosition         Position
+
+	// Change is the comparison with the previous day's recording of the region, if change detection is enabled
+	// and there was one
+	Change *ChangeResult
+
+	// Status, ClaimOwner and LeaseExpiry (unix seconds) track the claim held by the run processing the recording
+	Status      string
+	ClaimOwner  string
+	LeaseExpiry int64
+}
+
+// SolarTimeWindow is a time of day range used to filter recordings on their local solar time
+type SolarTimeWindow struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// RunRecord summarises a single invocation of the pipeline
+type RunRecord struct {
+	RunID     string
+	StartTime time.Time
+	EndTime   time.Time
+
+	// WindowStart and WindowEnd bound the recording dates considered by the run
+	WindowStart time.Time
+	WindowEnd   time.Time
+
+	DatesFetched     int
+	RecordingsSeen   int
+	Matched          int
+	Uploaded         int
+	Skipped          int
+	BytesTransferred int64
+
+	Errors             []string
+	NotificationStatus string
 }
 
 type recordingDetail struct {
-	Recordings        []*NasaEpicRecording
+	Recordings []*NasaEpicRecording
+	WebsiteURL string
+}
+
+type indexDetail struct {
+	// Records are the most recent recordings
+	Records           []*DBRecord
+	Total             int
+	Years             []*galleryYear
+	Feeds             []feedLink
+	TimeLapses        []timeLapseLink
 	FavIconS3Location string
-	WebsiteURL        string
 }
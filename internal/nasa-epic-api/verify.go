@@ -0,0 +1,254 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// repairClaimLease is how long RepairRecordings holds the claim it re-links an orphaned image under
+const repairClaimLease = time.Minute
+
+const (
+	// IssueMissingObject is a completed record whose image is not in the object store
+	IssueMissingObject = "missing-object"
+	// IssueOrphanObject is an image in the object store without a record
+	IssueOrphanObject = "orphan-object"
+	// IssueSizeMismatch is a record whose ImageSize differs from the size of its image
+	IssueSizeMismatch = "size-mismatch"
+	// IssueHashMismatch is a record whose ImageMD5 differs from the hash of its image
+	IssueHashMismatch = "hash-mismatch"
+	// IssueMissingHash is a record written before ImageMD5 was stored
+	IssueMissingHash = "missing-hash"
+)
+
+// Inconsistency is a single difference found between the recording store and the object store.
+// Record is nil for orphaned objects and Object is nil for missing objects
+type Inconsistency struct {
+	Issue  string
+	Key    string
+	Record *DBRecord
+	Object *ObjectInfo
+	Detail string
+}
+
+// VerifyRecordings lists every record and every image in the object store and returns the differences between them.
+// Images are the PNG objects under a 2006-01-02 prefix, other objects such as the index are ignored. Images
+// belonging to an in-progress claim are not orphans, as the run holding the claim will write the record. Claims carry
+// no image key, so are matched to images on their day and identifier
+func VerifyRecordings(store RecordingStore, objects ObjectStore) ([]Inconsistency, error) {
+	records, err := store.List(RecordingFilter{IncludeInProgress: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records: %v", err)
+	}
+
+	listed, err := objects.List("")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list objects: %v", err)
+	}
+
+	objectsByKey := map[string]*ObjectInfo{}
+	for i := range listed {
+		if isImageObjectKey(listed[i].Key) {
+			objectsByKey[listed[i].Key] = &listed[i]
+		}
+	}
+
+	var inconsistencies []Inconsistency
+	claimed := map[string]bool{}
+
+	for _, record := range records {
+		if !record.IsCompleted() {
+			claimed[recordClaimKey(record.Key())] = true
+			continue
+		}
+
+		objectKey := record.ObjectKey()
+
+		object, found := objectsByKey[objectKey]
+		delete(objectsByKey, objectKey)
+
+		inconsistency := Inconsistency{Key: objectKey, Record: record, Object: object}
+		switch {
+		case !found:
+			inconsistency.Issue = IssueMissingObject
+		case record.ImageSize != object.Size:
+			inconsistency.Issue = IssueSizeMismatch
+			inconsistency.Detail = fmt.Sprintf("record %d bytes, object %d bytes", record.ImageSize, object.Size)
+		case record.ImageMD5 == "":
+			inconsistency.Issue = IssueMissingHash
+		case isMD5ETag(object.ETag) && record.ImageMD5 != object.ETag:
+			inconsistency.Issue = IssueHashMismatch
+			inconsistency.Detail = fmt.Sprintf("record %s, object %s", record.ImageMD5, object.ETag)
+		default:
+			continue
+		}
+		inconsistencies = append(inconsistencies, inconsistency)
+	}
+
+	for objectKey, object := range objectsByKey {
+		if claimed[imageClaimKey(objectKey)] {
+			continue
+		}
+		inconsistencies = append(inconsistencies, Inconsistency{Issue: IssueOrphanObject, Key: objectKey, Object: object})
+	}
+
+	sort.Slice(inconsistencies, func(i, j int) bool {
+		return inconsistencies[i].Key < inconsistencies[j].Key
+	})
+
+	return inconsistencies, nil
+}
+
+// RepairRecordings resolves each inconsistency found by VerifyRecordings:
+//   - missing and mismatched images are downloaded from the EPIC archive again and their record updated
+//   - missing hashes are taken from the object when its ETag is an MD5 hash and its size matches
+//   - orphaned images still published by the EPIC API are re-linked by claiming and completing a record for them,
+//     assigned to regionName, and otherwise deleted. Images whose recording has since been claimed or recorded by
+//     a run are left to that run
+//
+// It returns the number of inconsistencies repaired
+func RepairRecordings(store RecordingStore, objects ObjectStore, regionName string, inconsistencies []Inconsistency) (int, error) {
+	// EPIC API responses keyed on the recording day then image name
+	apiRecordings := map[string]map[string]*NasaEpicRecording{}
+	repaired := 0
+
+	for _, inconsistency := range inconsistencies {
+		switch inconsistency.Issue {
+		case IssueMissingObject, IssueSizeMismatch, IssueHashMismatch:
+			record := inconsistency.Record
+			if record.Image == "" {
+				fmt.Printf("Unable to repair item %s as its image name is unknown, run migrate-schema first\n", record.Identifier)
+				continue
+			}
+
+			imageURL := archiveImageURL(record.Collection, record.Date.UTC(), record.Image)
+			s3Location, size, md5Hash, err := transferArchiveImage(objects, imageURL, inconsistency.Key)
+			if err != nil {
+				return repaired, fmt.Errorf("unable to restore image of item %s: %v", record.Identifier, err)
+			}
+
+			record.S3Location = s3Location
+			record.S3Key = inconsistency.Key
+			record.ImageSize = size
+			record.ImageMD5 = md5Hash
+			err = store.Put(*record)
+			if err != nil {
+				return repaired, fmt.Errorf("unable to write item %s: %v", record.Identifier, err)
+			}
+			fmt.Printf("Restored image of item %s\n", record.Identifier)
+
+		case IssueMissingHash:
+			record := inconsistency.Record
+			if !isMD5ETag(inconsistency.Object.ETag) {
+				fmt.Printf("Unable to backfill hash of item %s as its object was uploaded in parts\n", record.Identifier)
+				continue
+			}
+
+			record.ImageMD5 = inconsistency.Object.ETag
+			err := store.Put(*record)
+			if err != nil {
+				return repaired, fmt.Errorf("unable to write item %s: %v", record.Identifier, err)
+			}
+			fmt.Printf("Backfilled hash of item %s\n", record.Identifier)
+
+		case IssueOrphanObject:
+			day, image := splitImageObjectKey(inconsistency.Key)
+			if _, fetched := apiRecordings[day]; !fetched {
+				date, _ := time.Parse("2006-01-02", day)
+				recordings, err := GetRecordingsForDate(date)
+				if err != nil {
+					return repaired, fmt.Errorf("unable to fetch metadata for %s: %v", day, err)
+				}
+
+				apiRecordings[day] = map[string]*NasaEpicRecording{}
+				for _, recording := range recordings {
+					apiRecordings[day][recording.Image] = recording
+				}
+			}
+
+			recording, found := apiRecordings[day][image]
+			if !found {
+				err := objects.Delete(inconsistency.Key)
+				if err != nil {
+					return repaired, fmt.Errorf("unable to delete object %s: %v", inconsistency.Key, err)
+				}
+				fmt.Printf("Deleted orphaned object %s\n", inconsistency.Key)
+				repaired++
+				continue
+			}
+
+			recording.S3Location = objects.PublicURL(inconsistency.Key)
+			recording.S3Key = inconsistency.Key
+			recording.FormattedDateStr = recording.Date.Format("2006-01-02 03:04PM")
+			recording.ImageSize = inconsistency.Object.Size
+			if isMD5ETag(inconsistency.Object.ETag) {
+				recording.ImageMD5 = inconsistency.Object.ETag
+			}
+			recording.Region = regionName
+
+			// the record is written under a claim of its own rather than put, so that a run which claimed the
+			// recording after it was verified still completes and reports it
+			record := CreateDBRecordType(recording)
+			owner := "repair-" + NewRunID()
+			claimed, err := store.Claim(record.Key(), owner, time.Now().Add(repairClaimLease))
+			if err != nil {
+				return repaired, fmt.Errorf("unable to claim item %s: %v", record.Identifier, err)
+			}
+			if !claimed {
+				fmt.Printf("Skipping orphaned object %s as item %s has since been claimed or recorded\n", inconsistency.Key, record.Identifier)
+				continue
+			}
+
+			completed, err := store.Complete(record, owner)
+			if err != nil {
+				return repaired, fmt.Errorf("unable to write item %s: %v", record.Identifier, err)
+			}
+			if !completed {
+				fmt.Printf("Skipping orphaned object %s as item %s has since been claimed by another run\n", inconsistency.Key, record.Identifier)
+				continue
+			}
+			fmt.Printf("Re-linked orphaned object %s to item %s\n", inconsistency.Key, record.Identifier)
+		}
+
+		repaired++
+	}
+
+	return repaired, nil
+}
+
+// isImageObjectKey reports whether key is of the form 2006-01-02/image.png used for uploaded images
+func isImageObjectKey(key string) bool {
+	day, image := splitImageObjectKey(key)
+	if image == "" || path.Ext(key) != ".png" {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", day)
+	return err == nil
+}
+
+// splitImageObjectKey returns the day prefix and image name, without extension, of an image key
+func splitImageObjectKey(key string) (string, string) {
+	day, filename := path.Split(key)
+	return strings.TrimSuffix(day, "/"), strings.TrimSuffix(filename, path.Ext(filename))
+}
+
+// recordClaimKey returns the day and identifier of a recording, as matched against imageClaimKey
+func recordClaimKey(key RecordKey) string {
+	date, _ := time.Parse(time.RFC3339, key.Timestamp)
+	return date.Format("2006-01-02") + "/" + key.Identifier()
+}
+
+// imageClaimKey returns the day and identifier of the recording an image belongs to. EPIC image names end in the
+// identifier of their recording, e.g. 2023-01-01/epic_1b_20230101003633.png is recording 20230101003633
+func imageClaimKey(objectKey string) string {
+	day, image := splitImageObjectKey(objectKey)
+	return day + "/" + image[strings.LastIndex(image, "_")+1:]
+}
+
+// isMD5ETag reports whether an ETag is the MD5 hash of its object, which is not the case for multipart uploads
+func isMD5ETag(etag string) bool {
+	return len(etag) == 32 && !strings.Contains(etag, "-")
+}
@@ -0,0 +1,38 @@
+package nasa_epic_api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyRecordingsIgnoresImagesOfInProgressClaims(t *testing.T) {
+	store := NewMemoryRecordingStore()
+	objects := NewFileObjectStore(t.TempDir(), "")
+
+	// a run has claimed and uploaded the image of a recording, but not yet completed it
+	key := NewRecordKey(defaultCollection, "20230101003633", time.Date(2023, 1, 1, 0, 36, 33, 0, time.UTC))
+	claimed, err := store.Claim(key, "run-1", time.Now().Add(time.Hour))
+	if err != nil || !claimed {
+		t.Fatalf("unable to claim recording: %t, %v", claimed, err)
+	}
+
+	for _, objectKey := range []string{"2023-01-01/epic_1b_20230101003633.png", "2023-01-01/epic_1b_20230101020000.png"} {
+		_, err = objects.Put(objectKey, strings.NewReader("png"), "image/png", CacheControlStable)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inconsistencies, err := VerifyRecordings(store, objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inconsistencies) != 1 {
+		t.Fatalf("expected only the unclaimed image to be reported, got %+v", inconsistencies)
+	}
+	if inconsistencies[0].Issue != IssueOrphanObject || inconsistencies[0].Key != "2023-01-01/epic_1b_20230101020000.png" {
+		t.Errorf("expected the unclaimed image to be an orphan, got %s %s", inconsistencies[0].Issue, inconsistencies[0].Key)
+	}
+}
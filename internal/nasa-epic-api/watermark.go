@@ -0,0 +1,66 @@
+package nasa_epic_api
+
+import (
+	"fmt"
+	"time"
+)
+
+// watermarkID returns the key a watermark is stored under
+func watermarkID(collection, region string) string {
+	return "watermark#" + collection + "#" + region
+}
+
+// WatermarkStartDate returns the date a run should resume from: the day after the watermark of the region, or
+// fallback if no watermark has been recorded yet
+func WatermarkStartDate(runStore RunStore, region string, fallback time.Time) (time.Time, error) {
+	watermark, err := runStore.GetWatermark(defaultCollection, region)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to read watermark: %v", err)
+	}
+
+	if watermark.IsZero() {
+		fmt.Printf("no watermark recorded for region %s, selecting recordings since %v\n", region, fallback)
+		return fallback, nil
+	}
+
+	startDate := watermark.AddDate(0, 0, 1)
+	fmt.Printf("resuming region %s from watermark %s, selecting recordings since %v\n",
+		region, watermark.Format("2006-01-02"), startDate)
+
+	return startDate, nil
+}
+
+// NewWatermarkAdvancer returns a ProcessOptions.DateCompleted func which moves the watermark of the region
+// forward to each completed date. The most recent of availableDates is never used as the watermark, as EPIC may
+// still be publishing recordings for it, so that date is re-examined by the next run
+func NewWatermarkAdvancer(runStore RunStore, region string, availableDates []*Date) func(date *Date) error {
+	var latest time.Time
+	for _, date := range availableDates {
+		if date.Date.After(latest) {
+			latest = date.Date
+		}
+	}
+
+	return func(date *Date) error {
+		if !date.Date.Before(latest) {
+			fmt.Printf("not advancing watermark onto the most recent date %s\n", date.DateString)
+			return nil
+		}
+
+		watermark, err := runStore.GetWatermark(defaultCollection, region)
+		if err != nil {
+			return err
+		}
+		if !date.Date.After(watermark) {
+			return nil
+		}
+
+		err = runStore.PutWatermark(defaultCollection, region, date.Date)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("advanced watermark for region %s to %s\n", region, date.DateString)
+
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package nasa_epic_api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatermarkAdvancer(t *testing.T) {
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	dates := []*Date{
+		{DateString: "2023-01-01", Date: day},
+		{DateString: "2023-01-02", Date: day.AddDate(0, 0, 1)},
+		{DateString: "2023-01-03", Date: day.AddDate(0, 0, 2)},
+	}
+
+	tests := []struct {
+		name      string
+		completed []*Date
+		want      time.Time
+	}{
+		{"nothing completed", nil, time.Time{}},
+		{"advances in order", []*Date{dates[0], dates[1]}, dates[1].Date},
+		{"never advances onto the latest date", []*Date{dates[0], dates[1], dates[2]}, dates[1].Date},
+		{"never moves backwards", []*Date{dates[1], dates[0]}, dates[1].Date},
+	}
+
+	for _, test := range tests {
+		runStore := NewMemoryRunStore()
+		advance := NewWatermarkAdvancer(runStore, "default", dates)
+		for _, date := range test.completed {
+			err := advance(date)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, _ := runStore.GetWatermark(defaultCollection, "default")
+		if !got.Equal(test.want) {
+			t.Errorf("%s: watermark %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWatermarkStartDate(t *testing.T) {
+	fallback := time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC)
+	watermark := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	runStore := NewMemoryRunStore()
+	got, err := WatermarkStartDate(runStore, "default", fallback)
+	if err != nil || !got.Equal(fallback) {
+		t.Errorf("expected the fallback without a watermark, got %v, %v", got, err)
+	}
+
+	runStore.PutWatermark(defaultCollection, "default", watermark)
+	got, err = WatermarkStartDate(runStore, "default", fallback)
+	if err != nil || !got.Equal(watermark.AddDate(0, 0, 1)) {
+		t.Errorf("expected the day after the watermark, got %v, %v", got, err)
+	}
+
+	got, _ = WatermarkStartDate(runStore, "other", fallback)
+	if !got.Equal(fallback) {
+		t.Errorf("expected watermarks to be kept per region, got %v", got)
+	}
+}
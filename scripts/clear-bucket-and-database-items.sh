@@ -7,13 +7,13 @@ if [[ -z "${AWS_PROFILE}" ]]; then
   exit 1
 fi
 
-dbTableName="mike-price-test-recordings-2"
+dbTableName="mike-price-test-recordings-3"
 uploadS3BucketName="s3://mike-price-test-recordings-image-upload"
 
 aws s3 rm "${uploadS3BucketName}" --recursive
 
 aws dynamodb scan \
-  --attributes-to-get Identifier FormattedDateStr \
+  --attributes-to-get RecordID Timestamp \
   --table-name ${dbTableName} --query "Items[*]" \
   | jq --compact-output '.[]' \
   | tr '\n' '\0' \
@@ -5,8 +5,10 @@ if [[ -z "${AWS_PROFILE}" ]]; then
   exit 1
 fi
 
-aws dynamodb create-table --table-name mike-price-test-recordings-2 \
-  --attribute-definitions AttributeName=Identifier,AttributeType=S AttributeName=FormattedDateStr,AttributeType=S \
-  --key-schema AttributeName=Identifier,KeyType=HASH AttributeName=FormattedDateStr,KeyType=RANGE \
+aws dynamodb create-table --table-name mike-price-test-recordings-3 \
+  --attribute-definitions AttributeName=RecordID,AttributeType=S AttributeName=Timestamp,AttributeType=S \
+    AttributeName=DatePartition,AttributeType=S \
+  --key-schema AttributeName=RecordID,KeyType=HASH AttributeName=Timestamp,KeyType=RANGE \
+  --global-secondary-indexes 'IndexName=DateIndex,KeySchema=[{AttributeName=DatePartition,KeyType=HASH},{AttributeName=Timestamp,KeyType=RANGE}],Projection={ProjectionType=ALL}' \
   --billing-mode PAY_PER_REQUEST \
   --tags Key=Owner,Value="Michael Price" Key=Purpose,Value="Testing"
\ No newline at end of file
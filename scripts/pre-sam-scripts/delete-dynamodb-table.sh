@@ -5,4 +5,4 @@ if [[ -z "${AWS_PROFILE}" ]]; then
   exit 1
 fi
 
-aws dynamodb delete-table --table-name mike-price-test-recordings-2
+aws dynamodb delete-table --table-name mike-price-test-recordings-3
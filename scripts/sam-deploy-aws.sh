@@ -1,10 +1,6 @@
 #!/usr/bin/env bash
 
-# Build the app, copy the external files in and then deploy to AWS via Cloudformation
+# Build the app and then deploy to AWS via Cloudformation. Templates and assets are embedded in the binary
 
 sam build &&
-mkdir .aws-sam/build/MyFunction/images &&
-mkdir .aws-sam/build/MyFunction/internal &&
-cp -R images/ .aws-sam/build/MyFunction/images/ &&
-cp -R internal/ .aws-sam/build/MyFunction/internal/ &&
-sam deploy --no-confirm-changeset
\ No newline at end of file
+sam deploy --no-confirm-changeset